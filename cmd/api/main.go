@@ -3,7 +3,10 @@
 package main
 
 import (
+    "io";
+    "io/fs";
     "log";
+    "flag";
     "time";
     "fmt";
     "errors";
@@ -12,9 +15,14 @@ import (
 
     ls "jacobitosuperstar/LoanSizing/internal/loan_sizer";
     ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    ia "jacobitosuperstar/LoanSizing/internal/investment_analysis";
 )
 
 const PORT = ":8000";
+const LENDER_PROGRAMS_PATH = "config/lender_programs.json";
+
+// lender_programs are the lender program presets loaded at startup.
+var lender_programs ls.LenderPrograms
 
 
 type HealthCheckResponse struct {
@@ -25,15 +33,37 @@ type Response struct {
     Message string `json:"message"`
 }
 
+// LoanSizerResponse is the sized loan with the terms of the lender program
+// that were applied, if any, after the request overrides them.
+type LoanSizerResponse struct {
+    ls.LoanSizer
+    ProgramTerms    *ls.LenderProgram   `json:"program_terms,omitempty"`
+}
+
 
 func main() {
+    programs_path := flag.String("programs", LENDER_PROGRAMS_PATH, "lender programs config file")
+    flag.Parse()
+
+    var err error
+    lender_programs, err = ls.LoadLenderPrograms(*programs_path)
+    if errors.Is(err, fs.ErrNotExist) {
+        log.Printf("No lender programs config found in %s", *programs_path)
+    } else if err != nil {
+        log.Fatal(err)
+    }
+    log.Printf("Loaded %d lender programs", len(lender_programs))
+
     mux := http.NewServeMux()
     mux.HandleFunc("GET /", handleRoot)
     // TODO: Change this path to /health/ later.
     mux.HandleFunc("POST /loan_sizer", handleLoanSizer)
+    mux.HandleFunc("GET /lender_programs", handleLenderPrograms)
+    mux.HandleFunc("POST /loan_quotes/compare", handleCompareLoanQuotes)
+    mux.HandleFunc("POST /scenarios", handleScenarios)
 
     log.Printf("Server listening in the port %s", PORT)
-    err := http.ListenAndServe(PORT, mux)
+    err = http.ListenAndServe(PORT, mux)
     if err != nil {
         log.Fatal(err)
     }
@@ -52,15 +82,29 @@ func handleRoot(
     JSONResponse(w, http.StatusOK, response)
 }
 
+// handleLenderPrograms returns the available lender programs.
+func handleLenderPrograms(
+    w http.ResponseWriter,
+    r *http.Request,
+) {
+    JSONResponse(w, http.StatusOK, lender_programs)
+}
+
 // handleLoanSizer hadles the post request with the information to size the
 // loan and if everything is correct, returns the json representation of the
-// LoanSizer struct
+// LoanSizer struct. When the request names a lender program, the program
+// terms are used as defaults and the request fields override them.
 func handleLoanSizer(
     w http.ResponseWriter,
     r *http.Request,
 ) {
     var loan_sizer ls.LoanSizer
-    err := json.NewDecoder(r.Body).Decode(&loan_sizer)
+    var program_terms *ls.LenderProgram
+
+    body, err := io.ReadAll(r.Body)
+    if err == nil {
+        err = json.Unmarshal(body, &loan_sizer)
+    }
 
     if err != nil {
         response := Response{
@@ -70,12 +114,35 @@ func handleLoanSizer(
         return
     }
 
+    if loan_sizer.Program != "" {
+        program, ok := lender_programs[loan_sizer.Program]
+        if !ok {
+            response := Response{
+                Message: fmt.Sprintf("Unknown lender program: %s", loan_sizer.Program),
+            }
+            JSONResponse(w, http.StatusBadRequest, response)
+            return
+        }
+        // only the fields present in the request override the program.
+        loan_sizer = program.LoanSizer()
+        err = json.Unmarshal(body, &loan_sizer)
+        if err != nil {
+            response := Response{
+                Message: "Invalid request body",
+            }
+            JSONResponse(w, http.StatusBadRequest, response)
+            return
+        }
+        terms := program.Terms(loan_sizer)
+        program_terms = &terms
+    }
+
     loan_sizer, err = ls.InitLoanSizer(loan_sizer)
     if err != nil {
         var validationError *ff.ValidationError
         var response Response
 
-        if errors.Is(err, validationError) {
+        if errors.As(err, &validationError) {
             response = Response{
                 Message: fmt.Sprintf("Validation Error: %v", err),
             }
@@ -90,6 +157,90 @@ func handleLoanSizer(
         return
     }
 
-    JSONResponse(w, http.StatusOK, loan_sizer)
+    response := LoanSizerResponse{
+        LoanSizer: loan_sizer,
+        ProgramTerms: program_terms,
+    }
+    JSONResponse(w, http.StatusOK, response)
     return
 }
+
+// handleCompareLoanQuotes handles the post request with the property and the
+// lender quotes, and returns the comparison table of the sized quotes.
+func handleCompareLoanQuotes(
+    w http.ResponseWriter,
+    r *http.Request,
+) {
+    var request ia.QuoteComparisonRequest
+    err := json.NewDecoder(r.Body).Decode(&request)
+
+    if err != nil {
+        response := Response{
+            Message: "Invalid request body",
+        }
+        JSONResponse(w, http.StatusBadRequest, response)
+        return
+    }
+
+    comparison, err := ia.CompareLoanQuotes(request)
+    if err != nil {
+        var validationError *ff.ValidationError
+        var response Response
+
+        if errors.As(err, &validationError) {
+            response = Response{
+                Message: fmt.Sprintf("Validation Error: %v", err),
+            }
+            JSONResponse(w, http.StatusBadRequest, response)
+        } else {
+            response = Response{
+                Message: "Internal Server Error",
+            }
+            log.Println(err)
+            JSONResponse(w, http.StatusInternalServerError, response)
+        }
+        return
+    }
+
+    JSONResponse(w, http.StatusOK, comparison)
+}
+
+// handleScenarios handles the post request with the base deal and its
+// scenarios, and returns the metrics of every scenario next to the base.
+func handleScenarios(
+    w http.ResponseWriter,
+    r *http.Request,
+) {
+    var request ia.ScenarioSet
+    err := json.NewDecoder(r.Body).Decode(&request)
+
+    if err != nil {
+        response := Response{
+            Message: "Invalid request body",
+        }
+        JSONResponse(w, http.StatusBadRequest, response)
+        return
+    }
+
+    comparison, err := ia.RunScenarios(request)
+    if err != nil {
+        var validationError *ff.ValidationError
+        var response Response
+
+        if errors.As(err, &validationError) {
+            response = Response{
+                Message: fmt.Sprintf("Validation Error: %v", err),
+            }
+            JSONResponse(w, http.StatusBadRequest, response)
+        } else {
+            response = Response{
+                Message: "Internal Server Error",
+            }
+            log.Println(err)
+            JSONResponse(w, http.StatusInternalServerError, response)
+        }
+        return
+    }
+
+    JSONResponse(w, http.StatusOK, comparison)
+}
@@ -0,0 +1,204 @@
+// Day count conventions for interest accrual. The rate of a loan is quoted per
+// year, and the day count convention says which fraction of the year is
+// accrued between two dates.
+
+package financial_formulas
+
+import (
+    "fmt";
+    "time";
+    "math/big";
+)
+
+// DayCount is the day count convention of the interest accrual. It is written
+// as text, "30/360", "A/360" or "A/365".
+type DayCount int
+
+const (
+    DayCount30360 DayCount = iota
+    DayCountActual360
+    DayCountActual365
+)
+
+// day_count_names are the text representations of the conventions.
+var day_count_names = map[DayCount]string{
+    DayCount30360: "30/360",
+    DayCountActual360: "A/360",
+    DayCountActual365: "A/365",
+}
+
+// validate_day_count checks that the day count convention is one of the
+// supported ones.
+func validate_day_count(convention DayCount) error {
+    if _, ok := day_count_names[convention]; !ok {
+        return &ValidationError{"dayCount", convention, "The value must be 30/360, A/360 or A/365"}
+    }
+    return nil
+}
+
+// String returns the text representation of the convention.
+func (dc DayCount) String() string {
+    if name, ok := day_count_names[dc]; ok {
+        return name
+    }
+    return fmt.Sprintf("DayCount(%d)", int(dc))
+}
+
+// MarshalText returns the text representation of the convention.
+func (dc DayCount) MarshalText() ([]byte, error) {
+    err := validate_day_count(dc)
+    if err != nil {
+        return nil, err
+    }
+    return []byte(day_count_names[dc]), nil
+}
+
+// UnmarshalText parses the convention from its text representation.
+func (dc *DayCount) UnmarshalText(text []byte) error {
+    for convention, name := range day_count_names {
+        if string(text) == name {
+            *dc = convention
+            return nil
+        }
+    }
+    return &ValidationError{"dayCount", string(text), "The value must be 30/360, A/360 or A/365"}
+}
+
+// days_30360 returns the days between two dates counting every month as 30
+// days, following the 30/360 bond basis.
+func days_30360(start time.Time, end time.Time) int {
+    start_day, end_day := start.Day(), end.Day()
+    if start_day == 31 {
+        start_day = 30
+    }
+    if end_day == 31 && start_day == 30 {
+        end_day = 30
+    }
+    return 360*(end.Year()-start.Year()) + 30*(int(end.Month())-int(start.Month())) + (end_day - start_day)
+}
+
+// YearFraction returns the fraction of the year accrued from start to end
+// with the day count convention.
+func YearFraction(
+    convention DayCount,
+    start time.Time,
+    end time.Time,
+) (
+    fraction float64,
+    err error,
+) {
+    err = validate_day_count(convention)
+    if err != nil {
+        return 0.0, err
+    }
+    if end.Before(start) {
+        return 0.0, &ValidationError{"end", end, "The value must be after the start"}
+    }
+    actual_days := float64(end.Sub(start).Hours() / 24)
+    switch convention {
+    case DayCountActual360:
+        fraction = actual_days / 360
+    case DayCountActual365:
+        fraction = actual_days / 365
+    default:
+        fraction = float64(days_30360(start, end)) / 360
+    }
+    return fraction, nil
+}
+
+// NominalYearFraction returns the fraction accrued in a 365 days year with
+// the day count convention, for schedules that don't have dates.
+func NominalYearFraction(
+    convention DayCount,
+) (
+    fraction float64,
+    err error,
+) {
+    err = validate_day_count(convention)
+    if err != nil {
+        return 0.0, err
+    }
+    if convention == DayCountActual360 {
+        return 365.0 / 360.0, nil
+    }
+    return 1.0, nil
+}
+
+// AccruedInterest returns the interest accrued by the pv during the given
+// fraction of the period.
+func AccruedInterest(
+    rate float64,
+    pv Money,
+    fraction float64,
+) (
+    ipmt Money,
+    err error,
+) {
+    return DefaultRounding.AccruedInterest(rate, pv, fraction)
+}
+
+// AccruedInterest returns the interest accrued by the pv during the given
+// fraction of the period, rounded with the policy.
+func (rp RoundingPolicy) AccruedInterest(
+    rate float64,
+    pv Money,
+    fraction float64,
+) (
+    ipmt Money,
+    err error,
+) {
+    interest_rate := decimal_rat(rate * fraction)
+    if interest_rate == nil {
+        return 0, &ValidationError{"rate", rate, "The value must be a finite number"}
+    }
+    interest := new(big.Rat).Mul(big.NewRat(int64(pv), 1), interest_rate)
+    ipmt, err = rp.money(interest)
+    if err != nil {
+        return 0, err
+    }
+    return - ipmt, nil
+}
+
+// AccruedPayments returns the interest and principal payments of a loan with
+// a level payment that amortizes in numPeriods, where the interest of every
+// period accrues for the fraction of the period given in accruals. The
+// principal is the part of the payment left after the interest, so the
+// balance at the end is not forced to 0 and accruals can be shorter than the
+// amortization.
+func AccruedPayments(
+    rate float64,
+    numPeriods int,
+    pv Money,
+    accruals []float64,
+) (
+    ipmt []Money,
+    ppmt []Money,
+    err error,
+) {
+    return DefaultRounding.AccruedPayments(rate, numPeriods, pv, accruals)
+}
+
+// AccruedPayments returns the interest and principal payments of a loan with
+// a level payment that amortizes in numPeriods, where the interest of every
+// period accrues for the fraction of the period given in accruals, rounded
+// with the policy.
+func (rp RoundingPolicy) AccruedPayments(
+    rate float64,
+    numPeriods int,
+    pv Money,
+    accruals []float64,
+) (
+    ipmt []Money,
+    ppmt []Money,
+    err error,
+) {
+    err = rp.Validate()
+    if err != nil {
+        return ipmt, ppmt, err
+    }
+    pmt, err := payment(rate, numPeriods, pv.Float64(), 0, PayEnd)
+    if err != nil {
+        return ipmt, ppmt, fmt.Errorf("AccruedPayments internal error: %v", err)
+    }
+    return rp.amortize(rate, big.NewRat(int64(pv), 1), rp.payment_step(dollars_to_cents(pmt)), accruals, nil)
+}
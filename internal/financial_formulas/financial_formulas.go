@@ -1,11 +1,22 @@
-// Opinionated Financial Formulas. Every money value rounded down to 2 decimal
-// places.
+// Opinionated Financial Formulas. Every money value rounded to 2 decimal
+// places, unless the formula is calculated with another RoundingPolicy.
 // TODO: Formulas needed
 // [X] IOPayment (monthly)
 // [X] Payment (monthly)
 // [X] PrincipalPayment (monthly)
 // [X] InterestPayment (monthly)
 // [X] PresentValue
+// [X] NetPresentValue
+// [X] InternalRateOfReturn
+// [X] ExtendedInternalRateOfReturn
+// [X] Rate
+// [X] NPer
+// [X] FutureValue
+// [X] CumulativeInterest
+// [X] CumulativePrincipal
+// [X] GrowingAnnuityPresentValue
+// [X] GrowingPerpetuityPresentValue
+// [X] TermStructurePresentValue
 // If everything is already in years, this is not needed
 // [X] YearlyIOPayment
 // [X] YearlyPayment
@@ -13,9 +24,10 @@
 package financial_formulas
 
 import (
-    "log";
     "fmt";
+    "time";
 	"math";
+    "math/big";
 )
 
 const (
@@ -41,9 +53,20 @@ func IOPayment(
     pv float64,
 ) (
     pmt float64,
+) {
+    return DefaultRounding.IOPayment(rate, pv)
+}
+
+// IOPayment returns the interest only payment for a cash flow with a constant
+// interest rate, rounded with the policy.
+func (rp RoundingPolicy) IOPayment(
+    rate float64,
+    pv float64,
+) (
+    pmt float64,
 ) {
     pmt = - pv * rate
-    return Round2(pmt)
+    return rp.Round(pmt)
 }
 
 // // YearlyIOPayment returns the yearly interest only payment for a cash flow
@@ -58,9 +81,9 @@ func IOPayment(
 //     return Round2(pmt)
 // }
 
-// Payment returns the constant payment for a cash flow with a constant
-// interest rate.
-func Payment(
+// payment returns the constant payment for a cash flow with a constant
+// interest rate without rounding.
+func payment(
     rate float64,
     numPeriods int,
     pv float64,
@@ -81,7 +104,41 @@ func Payment(
 	} else {
 		pmt = (-pv - fv) / float64(numPeriods)
 	}
-	return Round2(pmt), nil
+	return pmt, nil
+}
+
+// Payment returns the constant payment for a cash flow with a constant
+// interest rate.
+func Payment(
+    rate float64,
+    numPeriods int,
+    pv float64,
+    fv float64,
+    paymentType int,
+) (
+    pmt float64,
+    err error,
+) {
+    return DefaultRounding.Payment(rate, numPeriods, pv, fv, paymentType)
+}
+
+// Payment returns the constant payment for a cash flow with a constant
+// interest rate, rounded with the policy.
+func (rp RoundingPolicy) Payment(
+    rate float64,
+    numPeriods int,
+    pv float64,
+    fv float64,
+    paymentType int,
+) (
+    pmt float64,
+    err error,
+) {
+    pmt, err = payment(rate, numPeriods, pv, fv, paymentType)
+    if err != nil {
+        return 0.0, err
+    }
+	return rp.Round(pmt), nil
 }
 
 // // YearlyPayment returns the yearly loan payment for a cash flow with a
@@ -104,9 +161,75 @@ func Payment(
 //     return Round2(12*pmt), nil
 // }
 
+// amortize returns the interest and principal payments of a level payment,
+// where the interest of every period accrues for the fraction of the period
+// given in accruals. The amounts are in cents and rounded with the policy.
+// With a fv, the last principal payment takes what is left of the balance, so
+// the balance always ends in the fv. The principal payments are the
+// differences of the rounded balances, so they always add up to the rounded
+// balance even when the policy rounds only on output.
+func (rp RoundingPolicy) amortize(
+    rate float64,
+    pv *big.Rat,
+    pmt *big.Rat,
+    accruals []float64,
+    fv *big.Rat,
+) (
+    ipmt []Money,
+    ppmt []Money,
+    err error,
+) {
+    capital := new(big.Rat).Set(pv)
+    reported_capital, err := rp.money(capital)
+    if err != nil {
+        return ipmt, ppmt, err
+    }
+    for i, fraction := range accruals {
+        if fraction <= 0 {
+            return ipmt, ppmt, &ValidationError{"accruals", fraction, "The accrual fraction of every period must be greater than 0"}
+        }
+        interest_rate := decimal_rat(rate * fraction)
+        if interest_rate == nil {
+            return ipmt, ppmt, &ValidationError{"rate", rate, "The value must be a finite number"}
+        }
+        interest_payment := rp.step(new(big.Rat).Neg(new(big.Rat).Mul(capital, interest_rate)))
+        principal_payment := new(big.Rat).Sub(pmt, interest_payment)
+        if fv != nil && i == len(accruals) - 1 {
+            principal_payment.Sub(fv, capital)
+        }
+        capital.Add(capital, principal_payment)
+
+        reported_interest, err := rp.money(interest_payment)
+        if err != nil {
+            return ipmt, ppmt, err
+        }
+        next_reported_capital, err := rp.money(capital)
+        if err != nil {
+            return ipmt, ppmt, err
+        }
+        ipmt = append(ipmt, reported_interest)
+        ppmt = append(ppmt, next_reported_capital - reported_capital)
+        reported_capital = next_reported_capital
+    }
+    return ipmt, ppmt, nil
+}
+
+// dollars_to_cents returns the float amount in dollars as a rational amount
+// in cents.
+func dollars_to_cents(amount float64) *big.Rat {
+    cents := decimal_rat(amount)
+    if cents == nil {
+        return new(big.Rat)
+    }
+    return cents.Mul(cents, big.NewRat(int64(Dollar), 1))
+}
+
 // InterestAndPrincipalPayment returns an array of interest payments, an
-// principal payments and an error.
-func interest_and_principal_payments(
+// principal payments and an error. The last principal payment takes the cents
+// left by the rounding of the payments, so the balance always ends in the fv.
+// With payments at the beginning of the periods the first payment is all
+// principal, and both arrays have a payment for every period.
+func (rp RoundingPolicy) interest_and_principal_payments(
     rate float64,
     numPeriods int,
     pv float64,
@@ -117,32 +240,60 @@ func interest_and_principal_payments(
     ppmt []float64,
     err error,
 ) {
-    pmt, err := Payment(rate, numPeriods, pv, fv, paymentType)
+    err = rp.Validate()
+    if err != nil {
+        return ipmt, ppmt, err
+    }
+    pmt, err := payment(rate, numPeriods, pv, fv, paymentType)
 
     if err != nil {
         return ipmt, ppmt, fmt.Errorf("interest_and_principal_payments internal error: %v", err)
     }
 
-    capital := pv
+    accruals := make([]float64, numPeriods)
+    for i := range accruals {
+        accruals[i] = 1.0
+    }
 
-    for i := 1; i <= numPeriods; i++ {
-        if paymentType == PayBegin && i == 1 {
-            ipmt = append(ipmt, 0.00)
-        } else {
-            interest_payment := Round2(- capital * rate)
-            ipmt = append(ipmt, interest_payment)
-            principal_payment := Round2(pmt - interest_payment)
-            ppmt = append(ppmt, principal_payment)
-            capital = capital + principal_payment
+    payment := rp.payment_step(dollars_to_cents(pmt))
+    capital := dollars_to_cents(pv)
+    future_value := dollars_to_cents(-fv)
+    if paymentType == PayBegin && numPeriods > 0 {
+        // the balance left after the last payment still accrues the interest
+        // of the last period before it ends in the fv.
+        growth := decimal_rat(1 + rate)
+        if growth == nil || growth.Sign() == 0 {
+            return ipmt, ppmt, &ValidationError{"rate", rate, "The value must be a finite number other than -1"}
         }
-    }
+        future_value.Quo(future_value, growth)
 
-    capital = Round2(capital)
+        // the first payment is made before any interest accrues, so it is all
+        // principal.
+        principal_payment := new(big.Rat).Set(payment)
+        if numPeriods == 1 {
+            principal_payment.Sub(future_value, capital)
+        }
+        next_capital := new(big.Rat).Add(capital, principal_payment)
+        reported_capital, err := rp.money(capital)
+        if err != nil {
+            return ipmt, ppmt, err
+        }
+        next_reported_capital, err := rp.money(next_capital)
+        if err != nil {
+            return ipmt, ppmt, err
+        }
+        ipmt = append(ipmt, 0.00)
+        ppmt = append(ppmt, (next_reported_capital - reported_capital).Float64())
+        capital = next_capital
+        accruals = accruals[1:]
+    }
 
-    if capital != fv {
-        log.Printf("Capital: %v  FV: %v", capital, fv)
-        return ipmt, ppmt, &ValidationError{"pv", capital, "pv doesnt' match fv at the end of the numPeriods"}
+    interest_payments, principal_payments, err := rp.amortize(rate, capital, payment, accruals, future_value)
+    if err != nil {
+        return ipmt, ppmt, fmt.Errorf("amortize internal error: %v", err)
     }
+    ipmt = append(ipmt, MoneyToFloat64(interest_payments)...)
+    ppmt = append(ppmt, MoneyToFloat64(principal_payments)...)
     return ipmt, ppmt, nil
 }
 
@@ -158,7 +309,22 @@ func PrincipalPayments(
     []float64,
     error,
 ) {
-    _, ppmt, err := interest_and_principal_payments(rate, numPeriods, pv, fv, paymentType)
+    return DefaultRounding.PrincipalPayments(rate, numPeriods, pv, fv, paymentType)
+}
+
+// PrincipalPayments return an array and an error of all the principal payments
+// during the number of periods, rounded with the policy.
+func (rp RoundingPolicy) PrincipalPayments(
+    rate float64,
+    numPeriods int,
+    pv float64,
+    fv float64,
+    paymentType int,
+) (
+    []float64,
+    error,
+) {
+    _, ppmt, err := rp.interest_and_principal_payments(rate, numPeriods, pv, fv, paymentType)
 
     if err != nil {
         return ppmt, fmt.Errorf("interest_and_principal_payments internal error: %v", err)
@@ -178,7 +344,22 @@ func InterestPayments(
     []float64,
     error,
 ) {
-    ipmt, _, err := interest_and_principal_payments(rate, numPeriods, pv, fv, paymentType)
+    return DefaultRounding.InterestPayments(rate, numPeriods, pv, fv, paymentType)
+}
+
+// InterestPayments returns an array and an error of all the interest payments
+// during the number of periods, rounded with the policy.
+func (rp RoundingPolicy) InterestPayments(
+    rate float64,
+    numPeriods int,
+    pv float64,
+    fv float64,
+    paymentType int,
+) (
+    []float64,
+    error,
+) {
+    ipmt, _, err := rp.interest_and_principal_payments(rate, numPeriods, pv, fv, paymentType)
 
     if err != nil {
         return ipmt, fmt.Errorf("interest_and_principal_payments internal error: %v", err)
@@ -197,6 +378,21 @@ func PresentValue(
 ) (
     pv float64,
     err error,
+) {
+    return DefaultRounding.PresentValue(rate, numPeriods, pmt, fv, paymentType)
+}
+
+// PresentValue return the present value of a cashflow with constant interest
+// rate and payments, rounded with the policy.
+func (rp RoundingPolicy) PresentValue(
+    rate float64,
+    numPeriods int,
+    pmt float64,
+    fv float64,
+    paymentType int,
+) (
+    pv float64,
+    err error,
 ) {
     if numPeriods <= 0 {
         return 0.0, &ValidationError{"numPeriods", numPeriods, "The value must be greater than 0"}
@@ -209,5 +405,587 @@ func PresentValue(
     } else {
         pv = -fv - pmt*float64(numPeriods)
     }
-    return Round2(pv), nil
+    return rp.Round(pv), nil
+}
+
+// future_value returns the future value of a cash flow with constant interest
+// rate and payments without rounding.
+func future_value(
+    rate float64,
+    numPeriods int,
+    pmt float64,
+    pv float64,
+    paymentType int,
+) (
+    fv float64,
+    err error,
+) {
+    if numPeriods < 0 {
+        return 0.0, &ValidationError{"numPeriods", numPeriods, "The value must be 0 or greater"}
+    }
+    if paymentType != PayEnd && paymentType != PayBegin {
+		return 0.0, &ValidationError{"paymentType", paymentType, "The value must be 0 (PayEnd) or 1 (PayBegin)"}
+    }
+    if rate != 0 {
+        fv = -(pv*math.Pow(1+rate, float64(numPeriods)) + pmt*(1+rate*float64(paymentType))*(math.Pow(1+rate, float64(numPeriods))-1)/rate)
+    } else {
+        fv = -(pv + pmt*float64(numPeriods))
+    }
+    return fv, nil
+}
+
+// FutureValue returns the future value of a cash flow with constant interest
+// rate and payments, the FV of a spreadsheet.
+func FutureValue(
+    rate float64,
+    numPeriods int,
+    pmt float64,
+    pv float64,
+    paymentType int,
+) (
+    fv float64,
+    err error,
+) {
+    return DefaultRounding.FutureValue(rate, numPeriods, pmt, pv, paymentType)
+}
+
+// FutureValue returns the future value of a cash flow with constant interest
+// rate and payments, rounded with the policy.
+func (rp RoundingPolicy) FutureValue(
+    rate float64,
+    numPeriods int,
+    pmt float64,
+    pv float64,
+    paymentType int,
+) (
+    fv float64,
+    err error,
+) {
+    fv, err = future_value(rate, numPeriods, pmt, pv, paymentType)
+    if err != nil {
+        return 0.0, err
+    }
+    return rp.Round(fv), nil
+}
+
+// balance_after returns the balance of a loan right after the payment of the
+// period, without rounding.
+func balance_after(
+    rate float64,
+    period int,
+    pmt float64,
+    pv float64,
+    paymentType int,
+) float64 {
+    if period == 0 {
+        return pv
+    }
+    // with payments at the beginning, the payment of the period is made
+    // before any interest is accrued on it.
+    if paymentType == PayBegin {
+        fv, _ := future_value(rate, period-1, pmt, pv, PayBegin)
+        return -fv + pmt
+    }
+    fv, _ := future_value(rate, period, pmt, pv, PayEnd)
+    return -fv
+}
+
+// cumulative_payments returns the interest and principal paid from the start
+// to the end period, both included, of a loan with constant payments that
+// amortizes in numPeriods, without rounding.
+func cumulative_payments(
+    rate float64,
+    numPeriods int,
+    pv float64,
+    start int,
+    end int,
+    paymentType int,
+) (
+    interest float64,
+    principal float64,
+    err error,
+) {
+    if start < 1 {
+        return 0.0, 0.0, &ValidationError{"start", start, "The value must be 1 or greater"}
+    }
+    if end < start || end > numPeriods {
+        return 0.0, 0.0, &ValidationError{"end", end, "The value must be between the start and numPeriods"}
+    }
+    pmt, err := payment(rate, numPeriods, pv, 0, paymentType)
+    if err != nil {
+        return 0.0, 0.0, err
+    }
+    principal = balance_after(rate, end, pmt, pv, paymentType) - balance_after(rate, start-1, pmt, pv, paymentType)
+    interest = pmt*float64(end-start+1) - principal
+    return interest, principal, nil
+}
+
+// CumulativeInterest returns the interest paid from the start to the end
+// period, both included, of a loan with constant payments, the CUMIPMT of a
+// spreadsheet.
+func CumulativeInterest(
+    rate float64,
+    numPeriods int,
+    pv float64,
+    start int,
+    end int,
+    paymentType int,
+) (
+    ipmt float64,
+    err error,
+) {
+    return DefaultRounding.CumulativeInterest(rate, numPeriods, pv, start, end, paymentType)
+}
+
+// CumulativeInterest returns the interest paid from the start to the end
+// period, both included, of a loan with constant payments, rounded with the
+// policy.
+func (rp RoundingPolicy) CumulativeInterest(
+    rate float64,
+    numPeriods int,
+    pv float64,
+    start int,
+    end int,
+    paymentType int,
+) (
+    ipmt float64,
+    err error,
+) {
+    ipmt, _, err = cumulative_payments(rate, numPeriods, pv, start, end, paymentType)
+    if err != nil {
+        return 0.0, fmt.Errorf("cumulative_payments internal error: %v", err)
+    }
+    return rp.Round(ipmt), nil
+}
+
+// CumulativePrincipal returns the principal paid from the start to the end
+// period, both included, of a loan with constant payments, the CUMPRINC of a
+// spreadsheet.
+func CumulativePrincipal(
+    rate float64,
+    numPeriods int,
+    pv float64,
+    start int,
+    end int,
+    paymentType int,
+) (
+    ppmt float64,
+    err error,
+) {
+    return DefaultRounding.CumulativePrincipal(rate, numPeriods, pv, start, end, paymentType)
+}
+
+// CumulativePrincipal returns the principal paid from the start to the end
+// period, both included, of a loan with constant payments, rounded with the
+// policy.
+func (rp RoundingPolicy) CumulativePrincipal(
+    rate float64,
+    numPeriods int,
+    pv float64,
+    start int,
+    end int,
+    paymentType int,
+) (
+    ppmt float64,
+    err error,
+) {
+    _, ppmt, err = cumulative_payments(rate, numPeriods, pv, start, end, paymentType)
+    if err != nil {
+        return 0.0, fmt.Errorf("cumulative_payments internal error: %v", err)
+    }
+    return rp.Round(ppmt), nil
+}
+
+// tvm returns the value of the time value of money equation, that is 0 when
+// the rate, number of periods, payment, pv and fv are consistent.
+func tvm(
+    rate float64,
+    numPeriods float64,
+    pmt float64,
+    pv float64,
+    fv float64,
+    paymentType int,
+) float64 {
+    if rate == 0 {
+        return pv + pmt*numPeriods + fv
+    }
+    growth := math.Pow(1+rate, numPeriods)
+    return pv*growth + pmt*(1+rate*float64(paymentType))*(growth-1)/rate + fv
+}
+
+// Rate returns the interest rate per period of a cash flow with constant
+// payments, the RATE of a spreadsheet.
+func Rate(
+    numPeriods int,
+    pmt float64,
+    pv float64,
+    fv float64,
+    paymentType int,
+) (
+    rate float64,
+    err error,
+) {
+    if numPeriods <= 0 {
+        return 0.0, &ValidationError{"numPeriods", numPeriods, "The value must be greater than 0"}
+    }
+    if paymentType != PayEnd && paymentType != PayBegin {
+		return 0.0, &ValidationError{"paymentType", paymentType, "The value must be 0 (PayEnd) or 1 (PayBegin)"}
+    }
+
+    // the cash flow is discounted to the start, so it stays finite at the
+    // high rates of the expanded bracket. Close to a total loss the discount
+    // overflows, and the future value of the cash flow has the same sign.
+    f := func(rate float64) float64 {
+        discount := math.Pow(1+rate, -float64(numPeriods))
+        if rate == 0 || math.IsInf(discount, 1) {
+            return tvm(rate, float64(numPeriods), pmt, pv, fv, paymentType)
+        }
+        return pv + pmt*(1+rate*float64(paymentType))*(1-discount)/rate + fv*discount
+    }
+
+    // bisection starting between a 99.99% loss and a 1000% rate per period,
+    // the equation is monotonic in the rate for a loan or an investment. When
+    // the rate is not bracketed the upper bound is expanded up to 1e6 and the
+    // lower bound up to a total loss.
+    low, high := -0.9999, 10.0
+    for f(low) * f(high) > 0 {
+        if high < 1e6 {
+            high *= 2
+        } else if 1+low > 1e-12 {
+            low = -1 + (1+low)/10
+        } else {
+            return 0.0, &ValueError{"rate", nil, "There is no rate between a total loss and 1e6 per period for the payment, pv and fv"}
+        }
+    }
+    for i := 0; i < 200; i++ {
+        rate = (low + high) / 2
+        if f(low) * f(rate) <= 0 {
+            high = rate
+        } else {
+            low = rate
+        }
+        if high - low < 1e-12 {
+            break
+        }
+    }
+    return (low + high) / 2, nil
+}
+
+// NPer returns the number of periods of a cash flow with constant payments and
+// interest rate, the NPER of a spreadsheet.
+func NPer(
+    rate float64,
+    pmt float64,
+    pv float64,
+    fv float64,
+    paymentType int,
+) (
+    numPeriods float64,
+    err error,
+) {
+    if rate <= -1 {
+        return 0.0, &ValidationError{"rate", rate, "The value must be greater than -1"}
+    }
+    if paymentType != PayEnd && paymentType != PayBegin {
+		return 0.0, &ValidationError{"paymentType", paymentType, "The value must be 0 (PayEnd) or 1 (PayBegin)"}
+    }
+    if rate == 0 {
+        if pmt == 0 {
+            return 0.0, &ValidationError{"pmt", pmt, "The value can't be 0 when the rate is 0"}
+        }
+        numPeriods = -(pv + fv) / pmt
+    } else {
+        adjusted_pmt := pmt * (1 + rate*float64(paymentType))
+        ratio := (adjusted_pmt - fv*rate) / (adjusted_pmt + pv*rate)
+        if ratio <= 0 {
+            return 0.0, &ValueError{"numPeriods", ratio, "The payment never pays off the pv"}
+        }
+        numPeriods = math.Log(ratio) / math.Log(1+rate)
+    }
+    if numPeriods < 0 || math.IsInf(numPeriods, 0) || math.IsNaN(numPeriods) {
+        return 0.0, &ValueError{"numPeriods", numPeriods, "The payment never pays off the pv"}
+    }
+    return numPeriods, nil
+}
+
+// NetPresentValue returns the net present value of a series of cash flows
+// with a constant discount rate. The first cash flow happens at period 0.
+func NetPresentValue(
+    rate float64,
+    values []float64,
+) (
+    npv float64,
+    err error,
+) {
+    return DefaultRounding.NetPresentValue(rate, values)
+}
+
+// NetPresentValue returns the net present value of a series of cash flows
+// with a constant discount rate, rounded with the policy.
+func (rp RoundingPolicy) NetPresentValue(
+    rate float64,
+    values []float64,
+) (
+    npv float64,
+    err error,
+) {
+    if rate <= -1 {
+        return 0.0, &ValidationError{"rate", rate, "The value must be greater than -1"}
+    }
+    for i, value := range values {
+        npv += value / math.Pow(1+rate, float64(i))
+    }
+    return rp.Round(npv), nil
+}
+
+// growing_annuity returns the present value of payments that grow with a
+// constant rate every period, without rounding. Like PresentValue, the present
+// value has the opposite sign of the payments.
+func growing_annuity(
+    rate float64,
+    growth float64,
+    numPeriods int,
+    pmt float64,
+    paymentType int,
+) (
+    pv float64,
+    err error,
+) {
+    if rate <= -1 {
+        return 0.0, &ValidationError{"rate", rate, "The value must be greater than -1"}
+    }
+    if numPeriods <= 0 {
+        return 0.0, &ValidationError{"numPeriods", numPeriods, "The value must be greater than 0"}
+    }
+    if paymentType != PayEnd && paymentType != PayBegin {
+		return 0.0, &ValidationError{"paymentType", paymentType, "The value must be 0 (PayEnd) or 1 (PayBegin)"}
+    }
+    if rate != growth {
+        pv = -pmt / (rate - growth) * (1 - math.Pow((1+growth)/(1+rate), float64(numPeriods)))
+    } else {
+        pv = -pmt * float64(numPeriods) / (1 + rate)
+    }
+    // payments at the beginning are discounted one period less.
+    return pv * (1 + rate*float64(paymentType)), nil
+}
+
+// GrowingAnnuityPresentValue returns the present value of numPeriods payments
+// that start at pmt and grow with a constant rate every period, like an
+// escalating rent.
+func GrowingAnnuityPresentValue(
+    rate float64,
+    growth float64,
+    numPeriods int,
+    pmt float64,
+    paymentType int,
+) (
+    pv float64,
+    err error,
+) {
+    return DefaultRounding.GrowingAnnuityPresentValue(rate, growth, numPeriods, pmt, paymentType)
+}
+
+// GrowingAnnuityPresentValue returns the present value of numPeriods payments
+// that start at pmt and grow with a constant rate every period, rounded with
+// the policy.
+func (rp RoundingPolicy) GrowingAnnuityPresentValue(
+    rate float64,
+    growth float64,
+    numPeriods int,
+    pmt float64,
+    paymentType int,
+) (
+    pv float64,
+    err error,
+) {
+    pv, err = growing_annuity(rate, growth, numPeriods, pmt, paymentType)
+    if err != nil {
+        return 0.0, err
+    }
+    return rp.Round(pv), nil
+}
+
+// GrowingPerpetuityPresentValue returns the present value of payments that
+// start at pmt and grow forever with a constant rate, the Gordon growth model
+// of the terminal values. The rate must be greater than the growth.
+func GrowingPerpetuityPresentValue(
+    rate float64,
+    growth float64,
+    pmt float64,
+    paymentType int,
+) (
+    pv float64,
+    err error,
+) {
+    return DefaultRounding.GrowingPerpetuityPresentValue(rate, growth, pmt, paymentType)
+}
+
+// GrowingPerpetuityPresentValue returns the present value of payments that
+// start at pmt and grow forever with a constant rate, rounded with the policy.
+func (rp RoundingPolicy) GrowingPerpetuityPresentValue(
+    rate float64,
+    growth float64,
+    pmt float64,
+    paymentType int,
+) (
+    pv float64,
+    err error,
+) {
+    if rate <= growth {
+        return 0.0, &ValidationError{"rate", rate, "The value must be greater than the growth"}
+    }
+    if growth <= -1 {
+        return 0.0, &ValidationError{"growth", growth, "The value must be greater than -1"}
+    }
+    if paymentType != PayEnd && paymentType != PayBegin {
+		return 0.0, &ValidationError{"paymentType", paymentType, "The value must be 0 (PayEnd) or 1 (PayBegin)"}
+    }
+    pv = -pmt / (rate - growth) * (1 + rate*float64(paymentType))
+    return rp.Round(pv), nil
+}
+
+// TermStructurePresentValue returns the present value of a series of cash
+// flows discounted with a term structure of yearly spot rates. The first cash
+// flow happens at the end of period 1 and is discounted with the first rate,
+// so there must be a rate for every cash flow. Like PresentValue, the present
+// value has the opposite sign of the cash flows.
+func TermStructurePresentValue(
+    rates []float64,
+    values []float64,
+) (
+    pv float64,
+    err error,
+) {
+    return DefaultRounding.TermStructurePresentValue(rates, values)
+}
+
+// TermStructurePresentValue returns the present value of a series of cash
+// flows discounted with a term structure of yearly spot rates, rounded with
+// the policy.
+func (rp RoundingPolicy) TermStructurePresentValue(
+    rates []float64,
+    values []float64,
+) (
+    pv float64,
+    err error,
+) {
+    if len(rates) != len(values) {
+        return 0.0, &ValidationError{"rates", rates, "There must be a rate for every cash flow"}
+    }
+    for i, value := range values {
+        if rates[i] <= -1 {
+            return 0.0, &ValidationError{"rates", rates[i], "Every rate must be greater than -1"}
+        }
+        pv -= value / math.Pow(1+rates[i], float64(i+1))
+    }
+    return rp.Round(pv), nil
+}
+
+// InternalRateOfReturn returns the discount rate that makes the net present
+// value of a series of cash flows equal to 0. The first cash flow happens at
+// period 0, and there must be at least one positive and one negative value.
+func InternalRateOfReturn(
+    values []float64,
+) (
+    irr float64,
+    err error,
+) {
+    has_positive, has_negative := false, false
+    for _, value := range values {
+        if value > 0 {
+            has_positive = true
+        }
+        if value < 0 {
+            has_negative = true
+        }
+    }
+    if !has_positive || !has_negative {
+        return 0.0, &ValidationError{"values", values, "There must be at least one positive and one negative value"}
+    }
+
+    npv := func(rate float64) float64 {
+        total := 0.0
+        for i, value := range values {
+            total += value / math.Pow(1+rate, float64(i))
+        }
+        return total
+    }
+    return find_rate(npv, values)
+}
+
+// find_rate returns the rate that makes the net present value equal to 0.
+func find_rate(
+    npv func(float64) float64,
+    values []float64,
+) (
+    irr float64,
+    err error,
+) {
+    // bisection between a total loss and a 1000% return, expanding the upper
+    // bound if the root is not bracketed. Close to a total loss the discounted
+    // cash flows of a long series overflow, and with both signs their sum has
+    // no sign, so the lower bound moves up until it has one.
+    low, high := -0.9999, 10.0
+    for math.IsNaN(npv(low)) && low < -0.9 {
+        low = -1 + (1+low)*10
+    }
+    for npv(low) * npv(high) > 0 {
+        high *= 2
+        if high > 1e6 {
+            return 0.0, &ValueError{"values", values, "The internal rate of return couldn't be found"}
+        }
+    }
+    for i := 0; i < 200; i++ {
+        irr = (low + high) / 2
+        if npv(low) * npv(irr) <= 0 {
+            high = irr
+        } else {
+            low = irr
+        }
+        if high - low < 1e-10 {
+            break
+        }
+    }
+    return (low + high) / 2, nil
+}
+
+// ExtendedInternalRateOfReturn returns the yearly discount rate that makes the
+// net present value of cash flows on irregular dates equal to 0, the XIRR of a
+// spreadsheet. Every cash flow is discounted for the actual days after the
+// first date over 365 days.
+func ExtendedInternalRateOfReturn(
+    values []float64,
+    dates []time.Time,
+) (
+    irr float64,
+    err error,
+) {
+    if len(dates) != len(values) {
+        return 0.0, &ValidationError{"dates", dates, "There must be a date for every cash flow"}
+    }
+    has_positive, has_negative := false, false
+    for i, value := range values {
+        if value > 0 {
+            has_positive = true
+        }
+        if value < 0 {
+            has_negative = true
+        }
+        if dates[i].Before(dates[0]) {
+            return 0.0, &ValidationError{"dates", dates[i], "No date can be before the first date"}
+        }
+    }
+    if !has_positive || !has_negative {
+        return 0.0, &ValidationError{"values", values, "There must be at least one positive and one negative value"}
+    }
+
+    npv := func(rate float64) float64 {
+        total := 0.0
+        for i, value := range values {
+            years := dates[i].Sub(dates[0]).Hours() / 24 / 365
+            total += value / math.Pow(1+rate, years)
+        }
+        return total
+    }
+    return find_rate(npv, values)
 }
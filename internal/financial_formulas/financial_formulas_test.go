@@ -8,9 +8,32 @@
 // [X] PrincipalPayment (monthly)
 // [X] InterestPayment (monthly)
 // [X] PresentValue
+// [X] NetPresentValue
+// [X] InternalRateOfReturn
+// [X] ExtendedInternalRateOfReturn
+// [X] Rate
+// [X] NPer
+// [X] FutureValue
+// [X] CumulativeInterest
+// [X] CumulativePrincipal
+// [X] GrowingAnnuityPresentValue
+// [X] GrowingPerpetuityPresentValue
+// [X] TermStructurePresentValue
+// [X] InterestRate
+// [X] YearFraction
+// [X] DayCount text
+// [X] AccruedPayments
+// [X] Money
+// [X] Money overflow
+// [X] RoundingPolicy
 
 package financial_formulas
-import "testing"
+import (
+    "math";
+    "time";
+    "errors";
+    "testing";
+)
 
 func TestRound2(t *testing.T) {
     var testCases = []struct {
@@ -113,6 +136,15 @@ func TestPayment(t *testing.T){
             paymentType: 0,
             want: -8.54,
         },
+        {
+            name: "Payments at the beginning",
+            rate: 0.00375,
+            numPeriods: 12,
+            pv: 100,
+            fv: 0,
+            paymentType: 1,
+            want: -8.51,
+        },
     }
 
     for _, test := range testCases {
@@ -227,7 +259,25 @@ func TestPrincipalPayments(t *testing.T){
             pv: 100,
             fv: 0,
             paymentType: 0,
-            want: []float64{-49.9, -50.09},
+            want: []float64{-49.9, -50.1},
+        },
+        {
+            name: "Payments at the beginning",
+            rate: 0.00375,
+            numPeriods: 2,
+            pv: 100,
+            fv: 0,
+            paymentType: 1,
+            want: []float64{-50.09, -49.91},
+        },
+        {
+            name: "Single payment at the beginning",
+            rate: 0.05,
+            numPeriods: 1,
+            pv: 1000,
+            fv: -500,
+            paymentType: 1,
+            want: []float64{-523.81},
         },
     }
 
@@ -294,6 +344,24 @@ func TestInterestPayments(t *testing.T){
             paymentType: 0,
             want: []float64{-0.38, -0.19},
         },
+        {
+            name: "Payments at the beginning",
+            rate: 0.00375,
+            numPeriods: 2,
+            pv: 100,
+            fv: 0,
+            paymentType: 1,
+            want: []float64{0, -0.19},
+        },
+        {
+            name: "Single payment at the beginning",
+            rate: 0.05,
+            numPeriods: 1,
+            pv: 1000,
+            fv: -500,
+            paymentType: 1,
+            want: []float64{0},
+        },
     }
 
     for _, test := range testCases {
@@ -359,6 +427,15 @@ func TestPresentValue(t *testing.T){
             paymentType: 0,
             want: -4909.07,
         },
+        {
+            name: "Payments at the beginning",
+            rate: 0.08,
+            numPeriods: 20,
+            pmt: 500,
+            fv: 0,
+            paymentType: 1,
+            want: -5301.8,
+        },
     }
 
     for _, test := range testCases {
@@ -370,3 +447,909 @@ func TestPresentValue(t *testing.T){
         })
     }
 }
+
+func TestNetPresentValue(t *testing.T){
+    var testCases = []struct {
+        name string
+        rate float64
+        values []float64
+        want float64
+    }{
+        {
+            name: "No cash flows",
+            rate: 0.10,
+            values: []float64{},
+            want: 0,
+        },
+        {
+            name: "Totally valid case",
+            rate: 0.10,
+            values: []float64{-1000, 300, 400, 500},
+            want: -21.04,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := NetPresentValue(test.rate, test.values)
+            if got != test.want {
+                t.Errorf("got: %g, wanted: %g", got, test.want)
+            }
+        })
+    }
+}
+
+func TestGrowingAnnuityPresentValue(t *testing.T){
+    var testCases = []struct {
+        name string
+        rate float64
+        growth float64
+        numPeriods int
+        pmt float64
+        paymentType int
+        want float64
+    }{
+        {
+            name: "Invalid numPeriods",
+            rate: 0.08,
+            growth: 0.03,
+            numPeriods: 0,
+            pmt: 100000,
+            paymentType: 0,
+            want: 0,
+        },
+        {
+            name: "No growth",
+            rate: 0.08,
+            growth: 0,
+            numPeriods: 20,
+            pmt: 500,
+            paymentType: 0,
+            want: -4909.07,
+        },
+        {
+            name: "Growth equal to the rate",
+            rate: 0.05,
+            growth: 0.05,
+            numPeriods: 10,
+            pmt: 105000,
+            paymentType: 0,
+            want: -1000000,
+        },
+        {
+            name: "Totally valid case",
+            rate: 0.08,
+            growth: 0.03,
+            numPeriods: 10,
+            pmt: 100000,
+            paymentType: 0,
+            want: -755013.37,
+        },
+        {
+            name: "Payments at the beginning",
+            rate: 0.08,
+            growth: 0.03,
+            numPeriods: 10,
+            pmt: 100000,
+            paymentType: 1,
+            want: -815414.44,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := GrowingAnnuityPresentValue(test.rate, test.growth, test.numPeriods, test.pmt, test.paymentType)
+            if got != test.want {
+                t.Errorf("got: %g, wanted: %g", got, test.want)
+            }
+        })
+    }
+}
+
+func TestGrowingPerpetuityPresentValue(t *testing.T){
+    var testCases = []struct {
+        name string
+        rate float64
+        growth float64
+        pmt float64
+        paymentType int
+        want float64
+    }{
+        {
+            name: "Growth greater than the rate",
+            rate: 0.03,
+            growth: 0.05,
+            pmt: 100000,
+            paymentType: 0,
+            want: 0,
+        },
+        {
+            name: "Totally valid case",
+            rate: 0.08,
+            growth: 0.03,
+            pmt: 100000,
+            paymentType: 0,
+            want: -2000000,
+        },
+        {
+            name: "Payments at the beginning",
+            rate: 0.08,
+            growth: 0.03,
+            pmt: 100000,
+            paymentType: 1,
+            want: -2160000,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := GrowingPerpetuityPresentValue(test.rate, test.growth, test.pmt, test.paymentType)
+            if got != test.want {
+                t.Errorf("got: %g, wanted: %g", got, test.want)
+            }
+        })
+    }
+}
+
+func TestTermStructurePresentValue(t *testing.T){
+    var testCases = []struct {
+        name string
+        rates []float64
+        values []float64
+        want float64
+    }{
+        {
+            name: "Missing rates",
+            rates: []float64{0.05},
+            values: []float64{100, 100},
+            want: 0,
+        },
+        {
+            name: "Flat term structure",
+            rates: []float64{0.08, 0.08, 0.08},
+            values: []float64{500, 500, 500},
+            want: -1288.55,
+        },
+        {
+            name: "Upward sloping term structure",
+            rates: []float64{0.04, 0.05, 0.06},
+            values: []float64{104, 110.25, 1191.016},
+            want: -1200,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := TermStructurePresentValue(test.rates, test.values)
+            if got != test.want {
+                t.Errorf("got: %g, wanted: %g", got, test.want)
+            }
+        })
+    }
+}
+
+func TestInternalRateOfReturn(t *testing.T){
+    var testCases = []struct {
+        name string
+        values []float64
+        want float64
+    }{
+        {
+            name: "Only negative values",
+            values: []float64{-1000, -300},
+            want: 0,
+        },
+        {
+            name: "Totally valid case",
+            values: []float64{-1000, 300, 400, 500},
+            want: 0.089,
+        },
+        {
+            name: "Loss",
+            values: []float64{-1000, 100, 100, 100},
+            want: -0.4244,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := InternalRateOfReturn(test.values)
+            if Round4(got) != test.want {
+                t.Errorf("got: %g, wanted: %g", Round4(got), test.want)
+            }
+        })
+    }
+}
+
+func TestInterestRate(t *testing.T){
+    var testCases = []struct {
+        name string
+        rate InterestRate
+        compounding int
+        want float64
+    }{
+        {
+            name: "Invalid compounding",
+            rate: NominalRate(0.06, 0),
+            compounding: CompoundingMonthly,
+            want: 0,
+        },
+        {
+            name: "Same compounding",
+            rate: NominalRate(0.06, CompoundingMonthly),
+            compounding: CompoundingMonthly,
+            want: 0.06,
+        },
+        {
+            name: "Monthly to effective",
+            rate: NominalRate(0.06, CompoundingMonthly),
+            compounding: CompoundingAnnual,
+            want: 0.0617,
+        },
+        {
+            name: "Bond-equivalent yield to monthly",
+            rate: NominalRate(0.06, CompoundingSemiAnnual),
+            compounding: CompoundingMonthly,
+            want: 0.0593,
+        },
+        {
+            name: "Effective to monthly",
+            rate: EffectiveRate(0.0617),
+            compounding: CompoundingMonthly,
+            want: 0.06,
+        },
+        {
+            name: "Continuous to effective",
+            rate: ContinuousRate(0.06),
+            compounding: CompoundingAnnual,
+            want: 0.0618,
+        },
+        {
+            name: "Monthly to continuous",
+            rate: NominalRate(0.06, CompoundingMonthly),
+            compounding: CompoundingContinuous,
+            want: 0.0599,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := test.rate.Convert(test.compounding)
+            if Round4(got.Rate) != test.want {
+                t.Errorf("got: %g, wanted: %g", got.Rate, test.want)
+            }
+        })
+    }
+
+    // a rate that compounds with the periods is divided exactly.
+    periodic, err := NominalRate(0.06, CompoundingMonthly).Periodic(12)
+    if err != nil || periodic != 0.005 {
+        t.Errorf("got: %g, wanted: 0.005, error: %v", periodic, err)
+    }
+}
+
+func TestExtendedInternalRateOfReturn(t *testing.T){
+    var testCases = []struct {
+        name string
+        values []float64
+        dates []time.Time
+        want float64
+    }{
+        {
+            name: "Missing dates",
+            values: []float64{-100, 110},
+            dates: []time.Time{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+            want: 0,
+        },
+        {
+            name: "One year",
+            values: []float64{-100, 110},
+            dates: []time.Time{
+                time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+                time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+            },
+            want: 0.1,
+        },
+        {
+            name: "Totally valid case",
+            values: []float64{-10000, 2750, 4250, 3250, 2750},
+            dates: []time.Time{
+                time.Date(2008, 1, 1, 0, 0, 0, 0, time.UTC),
+                time.Date(2008, 3, 1, 0, 0, 0, 0, time.UTC),
+                time.Date(2008, 10, 30, 0, 0, 0, 0, time.UTC),
+                time.Date(2009, 2, 15, 0, 0, 0, 0, time.UTC),
+                time.Date(2009, 4, 1, 0, 0, 0, 0, time.UTC),
+            },
+            want: 0.3734,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := ExtendedInternalRateOfReturn(test.values, test.dates)
+            if Round4(got) != test.want {
+                t.Errorf("got: %g, wanted: %g", got, test.want)
+            }
+        })
+    }
+}
+
+func TestYearFraction(t *testing.T){
+    var testCases = []struct {
+        name string
+        convention DayCount
+        start time.Time
+        end time.Time
+        want float64
+    }{
+        {
+            name: "Invalid convention",
+            convention: 5,
+            start: time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC),
+            end: time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+            want: 0,
+        },
+        {
+            name: "30/360 end of month",
+            convention: DayCount30360,
+            start: time.Date(2026, time.January, 31, 0, 0, 0, 0, time.UTC),
+            end: time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC),
+            want: 0.1667,
+        },
+        {
+            name: "Actual/360",
+            convention: DayCountActual360,
+            start: time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC),
+            end: time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+            want: 1.0139,
+        },
+        {
+            name: "Actual/365 leap year",
+            convention: DayCountActual365,
+            start: time.Date(2028, time.January, 1, 0, 0, 0, 0, time.UTC),
+            end: time.Date(2029, time.January, 1, 0, 0, 0, 0, time.UTC),
+            want: 1.0027,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := YearFraction(test.convention, test.start, test.end)
+            if Round4(got) != test.want {
+                t.Errorf("got: %g, wanted: %g", Round4(got), test.want)
+            }
+        })
+    }
+}
+
+func TestDayCountText(t *testing.T){
+    for _, convention := range []DayCount{DayCount30360, DayCountActual360, DayCountActual365} {
+        text, err := convention.MarshalText()
+        if err != nil {
+            t.Fatalf("unexpected error: %v", err)
+        }
+        var got DayCount
+        err = got.UnmarshalText(text)
+        if err != nil || got != convention {
+            t.Errorf("got: %v and %v, wanted: %v", got, err, convention)
+        }
+    }
+    var got DayCount
+    if err := got.UnmarshalText([]byte("ACT/ACT")); err == nil {
+        t.Errorf("got no error, wanted a validation error")
+    }
+    if _, err := DayCount(5).MarshalText(); err == nil {
+        t.Errorf("got no error, wanted a validation error")
+    }
+}
+
+func TestAccruedPayments(t *testing.T){
+    var testCases = []struct {
+        name string
+        accruals []float64
+        wantIpmt []Money
+        wantPpmt []Money
+    }{
+        {
+            name: "Invalid accrual",
+            accruals: []float64{0},
+            wantIpmt: []Money{},
+            wantPpmt: []Money{},
+        },
+        {
+            name: "Full periods",
+            accruals: []float64{1, 1},
+            wantIpmt: []Money{-38 * Cent, -19 * Cent},
+            wantPpmt: []Money{-4990 * Cent, -5009 * Cent},
+        },
+        {
+            name: "Short first period",
+            accruals: []float64{0.5, 1},
+            wantIpmt: []Money{-19 * Cent, -19 * Cent},
+            wantPpmt: []Money{-5009 * Cent, -5009 * Cent},
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            ipmt, ppmt, _ := AccruedPayments(0.00375, 2, 100 * Dollar, test.accruals)
+
+            if len(ipmt) != len(test.wantIpmt) || len(ppmt) != len(test.wantPpmt) {
+                t.Errorf("got: %v and %v, wanted: %v and %v", ipmt, ppmt, test.wantIpmt, test.wantPpmt)
+            } else {
+                for i := range ipmt {
+                    if ipmt[i] != test.wantIpmt[i] || ppmt[i] != test.wantPpmt[i] {
+                        t.Errorf("got: %v and %v, wanted: %v and %v", ipmt[i], ppmt[i], test.wantIpmt[i], test.wantPpmt[i])
+                    }
+                }
+            }
+        })
+    }
+}
+
+func TestMoney(t *testing.T){
+    var testCases = []struct {
+        name string
+        got Money
+        want Money
+    }{
+        {"NewMoney rounds to the cent", NewMoney(1.995), 200 * Cent},
+        {"NewMoney negative", NewMoney(-0.375), -38 * Cent},
+        {"Mul with decimal rate", (100 * Dollar).Mul(0.00375), 38 * Cent},
+        {"Div", (80000 * Dollar).Div(0.05), 1600000 * Dollar},
+        {"Floor to the dollar", (150099 * Cent).Floor(Dollar), 1500 * Dollar},
+        {"Floor negative", (-150001 * Cent).Floor(Dollar), -1501 * Dollar},
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            if test.got != test.want {
+                t.Errorf("got: %v, wanted: %v", test.got, test.want)
+            }
+        })
+    }
+}
+
+func TestMoneyJSON(t *testing.T){
+    var testCases = []struct {
+        input string
+        want Money
+        wantJSON string
+    }{
+        {"1500000", 1500000 * Dollar, "1500000.00"},
+        {"0.1", 10 * Cent, "0.10"},
+        {"-8.545", -855 * Cent, "-8.55"},
+        {"\"2500.05\"", 250005 * Cent, "2500.05"},
+    }
+
+    for _, test := range testCases {
+        var got Money
+        if err := got.UnmarshalJSON([]byte(test.input)); err != nil || got != test.want {
+            t.Errorf("got: %v, wanted: %v, error: %v", got, test.want, err)
+        }
+        if data, _ := got.MarshalJSON(); string(data) != test.wantJSON {
+            t.Errorf("got: %s, wanted: %s", data, test.wantJSON)
+        }
+    }
+}
+
+func TestMoneyOverflow(t *testing.T){
+    var valueError *ValueError
+    if _, err := ParseMoney("100000000000000000000"); !errors.As(err, &valueError) {
+        t.Errorf("got: %v, wanted a value error", err)
+    }
+    if _, err := DefaultRounding.Money(1e20); !errors.As(err, &valueError) {
+        t.Errorf("got: %v, wanted a value error", err)
+    }
+    if _, err := AccruedInterest(1e10, Money(math.MaxInt64), 1); !errors.As(err, &valueError) {
+        t.Errorf("got: %v, wanted a value error", err)
+    }
+    defer func () {
+        if err, ok := recover().(*ValueError); !ok {
+            t.Errorf("got: %v, wanted a value error", err)
+        }
+    }()
+    Money(math.MaxInt64).Mul(2)
+}
+
+func TestPaymentsReconcile(t *testing.T){
+    // 25 years of rounded payments used to end a few cents away from 0.
+    ppmt, err := PrincipalPayments(0.065, 25, 3635905, 0, 0)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    balance := NewMoney(3635905)
+    for _, principal_payment := range ppmt {
+        balance += NewMoney(principal_payment)
+    }
+    if balance != 0 {
+        t.Errorf("got: %v, wanted: 0.00", balance)
+    }
+}
+
+func TestPaymentsReconcileAtTheBeginning(t *testing.T){
+    // the balance left after the last payment at the beginning accrues the
+    // interest of the last period before it is paid as the fv.
+    var testCases = []struct {
+        name string
+        fv float64
+        want Money
+    }{
+        {
+            name: "Fully amortizing",
+            fv: 0,
+            want: 0,
+        },
+        {
+            name: "With balloon",
+            fv: -1000000,
+            want: 93896714 * Cent,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            pmt, _ := Payment(0.065, 25, 3635905, test.fv, PayBegin)
+            ipmt, _ := InterestPayments(0.065, 25, 3635905, test.fv, PayBegin)
+            ppmt, err := PrincipalPayments(0.065, 25, 3635905, test.fv, PayBegin)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if len(ipmt) != 25 || len(ppmt) != 25 {
+                t.Fatalf("got: %d and %d payments, wanted: 25", len(ipmt), len(ppmt))
+            }
+            if ipmt[0] != 0 || ppmt[0] != pmt {
+                t.Errorf("got: %g and %g, wanted: 0 and %g", ipmt[0], ppmt[0], pmt)
+            }
+            balance := NewMoney(3635905)
+            for _, principal_payment := range ppmt {
+                balance += NewMoney(principal_payment)
+            }
+            if balance != test.want {
+                t.Errorf("got: %v, wanted: %v", balance, test.want)
+            }
+        })
+    }
+}
+
+func TestRoundingPolicy(t *testing.T){
+    var testCases = []struct {
+        name string
+        policy RoundingPolicy
+        input float64
+        want float64
+    }{
+        {"Default half up", DefaultRounding, 0.125, 0.13},
+        {"Zero value is a cent half up", RoundingPolicy{}, -0.125, -0.13},
+        {"Half even down", RoundingPolicy{Mode: RoundHalfEven}, 0.125, 0.12},
+        {"Half even up", RoundingPolicy{Mode: RoundHalfEven}, 0.135, 0.14},
+        {"Whole dollars", RoundingPolicy{Precision: Dollar}, 8.54, 9},
+        {"Whole dollars half even", RoundingPolicy{Mode: RoundHalfEven, Precision: Dollar}, 8.5, 8},
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            if got := test.policy.Round(test.input); got != test.want {
+                t.Errorf("got: %g, wanted: %g", got, test.want)
+            }
+        })
+    }
+}
+
+func TestRoundingPolicyScopes(t *testing.T){
+    var testCases = []struct {
+        name string
+        policy RoundingPolicy
+        wantIpmt []float64
+    }{
+        {
+            name: "Each step",
+            policy: RoundingPolicy{Scope: RoundEachStep},
+            wantIpmt: []float64{-80, -55.36, -28.74},
+        },
+        {
+            name: "Payment only",
+            policy: RoundingPolicy{Scope: RoundPaymentOnly},
+            wantIpmt: []float64{-80, -55.36, -28.74},
+        },
+        {
+            name: "On output with whole dollars",
+            policy: RoundingPolicy{Scope: RoundOnOutput, Precision: Dollar},
+            wantIpmt: []float64{-80, -55, -29},
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            ipmt, _ := test.policy.InterestPayments(0.08, 3, 1000, 0, 0)
+            ppmt, _ := test.policy.PrincipalPayments(0.08, 3, 1000, 0, 0)
+
+            balance := NewMoney(1000)
+            for i := range ipmt {
+                if ipmt[i] != test.wantIpmt[i] {
+                    t.Errorf("got: %g, wanted: %g", ipmt[i], test.wantIpmt[i])
+                }
+                balance += NewMoney(ppmt[i])
+            }
+            if balance != 0 {
+                t.Errorf("got: %v, wanted: 0.00", balance)
+            }
+        })
+    }
+
+    if err := (RoundingPolicy{Mode: 3}).Validate(); err == nil {
+        t.Errorf("got no error, wanted a validation error for the mode")
+    }
+}
+
+func TestRate(t *testing.T){
+    var testCases = []struct {
+        name string
+        numPeriods int
+        pmt float64
+        pv float64
+        fv float64
+        paymentType int
+        want float64
+    }{
+        {
+            name: "Invalid numPeriods",
+            numPeriods: 0,
+            pmt: -100,
+            pv: 800,
+            fv: 0,
+            paymentType: 0,
+            want: 0,
+        },
+        {
+            name: "Invalid paymentType",
+            numPeriods: 10,
+            pmt: -100,
+            pv: 800,
+            fv: 0,
+            paymentType: 5,
+            want: 0,
+        },
+        {
+            name: "No interest",
+            numPeriods: 10,
+            pmt: -100,
+            pv: 1000,
+            fv: 0,
+            paymentType: 0,
+            want: 0,
+        },
+        {
+            name: "Totally valid case",
+            numPeriods: 10,
+            pmt: -100,
+            pv: 800,
+            fv: 0,
+            paymentType: 0,
+            want: 0.0428,
+        },
+        {
+            name: "Payment at the beginning",
+            numPeriods: 10,
+            pmt: -100,
+            pv: 800,
+            fv: 0,
+            paymentType: 1,
+            want: 0.0534,
+        },
+        {
+            name: "Rate above the initial bracket",
+            numPeriods: 1,
+            pmt: -2000,
+            pv: 100,
+            fv: 0,
+            paymentType: 0,
+            want: 19,
+        },
+        {
+            name: "Loss close to total",
+            numPeriods: 2,
+            pmt: 0,
+            pv: 1000000,
+            fv: -0.0001,
+            paymentType: 0,
+            want: -1,
+        },
+        {
+            name: "Monthly payments of a long loan",
+            numPeriods: 300,
+            pmt: -10000,
+            pv: 1481026,
+            fv: 0,
+            paymentType: 0,
+            want: 0.0054,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := Rate(test.numPeriods, test.pmt, test.pv, test.fv, test.paymentType)
+            if Round4(got) != test.want {
+                t.Errorf("got: %g, wanted: %g", Round4(got), test.want)
+            }
+        })
+    }
+}
+
+func TestNPer(t *testing.T){
+    var testCases = []struct {
+        name string
+        rate float64
+        pmt float64
+        pv float64
+        fv float64
+        paymentType int
+        want float64
+    }{
+        {
+            name: "Invalid paymentType",
+            rate: 0.01,
+            pmt: -100,
+            pv: 1000,
+            fv: 0,
+            paymentType: 5,
+            want: 0,
+        },
+        {
+            name: "Payment smaller than the interest",
+            rate: 0.2,
+            pmt: -100,
+            pv: 1000,
+            fv: 0,
+            paymentType: 0,
+            want: 0,
+        },
+        {
+            name: "No interest",
+            rate: 0,
+            pmt: -100,
+            pv: 1000,
+            fv: 0,
+            paymentType: 0,
+            want: 10,
+        },
+        {
+            name: "Totally valid case",
+            rate: 0.01,
+            pmt: -100,
+            pv: 1000,
+            fv: 0,
+            paymentType: 0,
+            want: 10.5886,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := NPer(test.rate, test.pmt, test.pv, test.fv, test.paymentType)
+            if Round4(got) != test.want {
+                t.Errorf("got: %g, wanted: %g", Round4(got), test.want)
+            }
+        })
+    }
+}
+
+func TestFutureValue(t *testing.T){
+    var testCases = []struct {
+        name string
+        rate float64
+        numPeriods int
+        pmt float64
+        pv float64
+        paymentType int
+        want float64
+    }{
+        {
+            name: "Invalid paymentType",
+            rate: 0.005,
+            numPeriods: 10,
+            pmt: -200,
+            pv: -500,
+            paymentType: 5,
+            want: 0,
+        },
+        {
+            name: "No interest",
+            rate: 0,
+            numPeriods: 10,
+            pmt: -200,
+            pv: -500,
+            paymentType: 0,
+            want: 2500,
+        },
+        {
+            name: "Totally valid case",
+            rate: 0.005,
+            numPeriods: 10,
+            pmt: -200,
+            pv: -500,
+            paymentType: 1,
+            want: 2581.4,
+        },
+        {
+            name: "Balance of a loan",
+            rate: 0.00375,
+            numPeriods: 1,
+            pmt: -50.28,
+            pv: 100,
+            paymentType: 0,
+            want: -50.1,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, _ := FutureValue(test.rate, test.numPeriods, test.pmt, test.pv, test.paymentType)
+            if got != test.want {
+                t.Errorf("got: %g, wanted: %g", got, test.want)
+            }
+        })
+    }
+}
+
+func TestCumulativePayments(t *testing.T){
+    var testCases = []struct {
+        name string
+        start int
+        end int
+        paymentType int
+        wantInterest float64
+        wantPrincipal float64
+    }{
+        {
+            name: "Invalid start",
+            start: 0,
+            end: 12,
+            paymentType: 0,
+            wantInterest: 0,
+            wantPrincipal: 0,
+        },
+        {
+            name: "Invalid end",
+            start: 13,
+            end: 361,
+            paymentType: 0,
+            wantInterest: 0,
+            wantPrincipal: 0,
+        },
+        {
+            name: "First payment",
+            start: 1,
+            end: 1,
+            paymentType: 0,
+            wantInterest: -937.5,
+            wantPrincipal: -68.28,
+        },
+        {
+            name: "Second year",
+            start: 13,
+            end: 24,
+            paymentType: 0,
+            wantInterest: -11135.23,
+            wantPrincipal: -934.11,
+        },
+        {
+            name: "First payment at the beginning",
+            start: 1,
+            end: 1,
+            paymentType: 1,
+            wantInterest: 0,
+            wantPrincipal: -998.29,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            interest, _ := CumulativeInterest(0.0075, 360, 125000, test.start, test.end, test.paymentType)
+            principal, _ := CumulativePrincipal(0.0075, 360, 125000, test.start, test.end, test.paymentType)
+            if interest != test.wantInterest || principal != test.wantPrincipal {
+                t.Errorf("got: %g and %g, wanted: %g and %g", interest, principal, test.wantInterest, test.wantPrincipal)
+            }
+        })
+    }
+}
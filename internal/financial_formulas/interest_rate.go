@@ -0,0 +1,130 @@
+// Interest rates with their compounding frequency. Rates are quoted as nominal
+// yearly rates compounded monthly, as semi-annual bond-equivalent yields or as
+// effective yearly rates, so the InterestRate carries the compounding of the
+// quote and converts it to the periodic rate of the payments.
+
+package financial_formulas
+
+import (
+    "math";
+)
+
+// Compounding frequencies, in compounding periods per year.
+const (
+    CompoundingContinuous = -1
+    CompoundingAnnual = 1
+    CompoundingSemiAnnual = 2
+    CompoundingQuarterly = 4
+    CompoundingMonthly = 12
+    CompoundingDaily = 365
+)
+
+// InterestRate is a nominal yearly rate compounded Compounding times per year.
+// With continuous compounding the rate is the force of interest.
+type InterestRate struct {
+    Rate        float64     `json:"rate"`
+    Compounding int         `json:"compounding"`
+}
+
+// NominalRate returns the nominal yearly rate compounded with the frequency.
+func NominalRate(rate float64, compounding int) InterestRate {
+    return InterestRate{Rate: rate, Compounding: compounding}
+}
+
+// EffectiveRate returns the effective yearly rate, that is a rate compounded
+// once a year.
+func EffectiveRate(rate float64) InterestRate {
+    return InterestRate{Rate: rate, Compounding: CompoundingAnnual}
+}
+
+// ContinuousRate returns the continuously compounded yearly rate.
+func ContinuousRate(rate float64) InterestRate {
+    return InterestRate{Rate: rate, Compounding: CompoundingContinuous}
+}
+
+// PeriodicRate returns the rate of a period, where there are periodsPerYear
+// periods in a year.
+func PeriodicRate(rate float64, periodsPerYear int) InterestRate {
+    return InterestRate{Rate: rate * float64(periodsPerYear), Compounding: periodsPerYear}
+}
+
+// validate_compounding checks that the compounding frequency is continuous or
+// has at least one period per year.
+func validate_compounding(field string, compounding int) error {
+    if compounding != CompoundingContinuous && compounding <= 0 {
+        return &ValidationError{field, compounding, "The value must be -1 (continuous) or the compounding periods per year"}
+    }
+    return nil
+}
+
+// Validate checks the compounding of the rate, and that it doesn't lose more
+// than the whole amount in a period.
+func (r InterestRate) Validate() error {
+    err := validate_compounding("compounding", r.Compounding)
+    if err != nil {
+        return err
+    }
+    if math.IsNaN(r.Rate) || math.IsInf(r.Rate, 0) {
+        return &ValidationError{"rate", r.Rate, "The value must be a finite number"}
+    }
+    if r.Compounding != CompoundingContinuous && r.Rate <= -float64(r.Compounding) {
+        return &ValidationError{"rate", r.Rate, "The periodic rate must be greater than -1"}
+    }
+    return nil
+}
+
+// growth returns the growth factor of the rate in a fraction of a year.
+func (r InterestRate) growth(years float64) float64 {
+    if r.Compounding == CompoundingContinuous {
+        return math.Exp(r.Rate * years)
+    }
+    return math.Pow(1+r.Rate/float64(r.Compounding), float64(r.Compounding)*years)
+}
+
+// Effective returns the effective yearly rate.
+func (r InterestRate) Effective() float64 {
+    if r.Compounding == CompoundingAnnual {
+        return r.Rate
+    }
+    return r.growth(1) - 1
+}
+
+// Periodic returns the rate of a period, where there are periodsPerYear
+// periods in a year. When the rate compounds with the periods it is the
+// nominal rate divided by the periods.
+func (r InterestRate) Periodic(periodsPerYear int) (float64, error) {
+    err := r.Validate()
+    if err != nil {
+        return 0.0, err
+    }
+    if periodsPerYear <= 0 {
+        return 0.0, &ValidationError{"periodsPerYear", periodsPerYear, "The value must be greater than 0"}
+    }
+    if r.Compounding == periodsPerYear {
+        return r.Rate / float64(periodsPerYear), nil
+    }
+    return r.growth(1/float64(periodsPerYear)) - 1, nil
+}
+
+// Convert returns the equivalent rate with another compounding frequency.
+func (r InterestRate) Convert(compounding int) (InterestRate, error) {
+    err := r.Validate()
+    if err != nil {
+        return InterestRate{}, err
+    }
+    err = validate_compounding("compounding", compounding)
+    if err != nil {
+        return InterestRate{}, err
+    }
+    if r.Compounding == compounding {
+        return r, nil
+    }
+    if compounding == CompoundingContinuous {
+        return ContinuousRate(math.Log(r.growth(1))), nil
+    }
+    periodic, err := r.Periodic(compounding)
+    if err != nil {
+        return InterestRate{}, err
+    }
+    return PeriodicRate(periodic, compounding), nil
+}
@@ -0,0 +1,179 @@
+// Money is a fixed-point decimal amount of currency with cent precision. Sums
+// and differences are exact, and products and quotients with rates are
+// calculated with arbitrary precision and rounded to the cent only once, so
+// schedules always reconcile to the cent.
+
+package financial_formulas
+
+import (
+    "fmt";
+    "math";
+    "math/big";
+    "strconv";
+    "encoding/json";
+)
+
+// Money is an amount of cents. Amounts are written as multiples of the units,
+// for example 1500 * Dollar.
+type Money int64
+
+const (
+    Cent    Money = 1
+    Dollar  Money = 100
+)
+
+// round_rat returns the rational rounded to the closest integer, with halves
+// rounded away from zero like math.Round. Amounts that don't fit in Money are
+// a ValueError.
+func round_rat(r *big.Rat) (Money, error) {
+    return int_money(round_int(r, RoundHalfUp))
+}
+
+// int_money returns the integer amount of cents as Money, or a ValueError when
+// it doesn't fit.
+func int_money(cents *big.Int) (Money, error) {
+    if !cents.IsInt64() {
+        return 0, &ValueError{"amount", cents.String(), "The amount of cents overflows Money"}
+    }
+    return Money(cents.Int64()), nil
+}
+
+// must_round_rat returns the rational rounded like round_rat, and panics with
+// the ValueError when it doesn't fit in Money, like the overflow of any other
+// integer arithmetic that can't return an error.
+func must_round_rat(r *big.Rat) Money {
+    m, err := round_rat(r)
+    if err != nil {
+        panic(err)
+    }
+    return m
+}
+
+// decimal_rat returns the shortest decimal representation of the float number
+// as a rational, so a rate of 0.00375 is exactly 375/100000 and not its binary
+// approximation.
+func decimal_rat(f float64) *big.Rat {
+    if math.IsNaN(f) || math.IsInf(f, 0) {
+        return nil
+    }
+    r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+    return r
+}
+
+// NewMoney returns the amount rounded to the cent. It panics when the amount
+// doesn't fit in Money.
+func NewMoney(amount float64) Money {
+    return Dollar.Mul(amount)
+}
+
+// ParseMoney returns the decimal amount rounded to the cent.
+func ParseMoney(amount string) (Money, error) {
+    r, ok := new(big.Rat).SetString(amount)
+    if !ok {
+        return 0, &ValueError{"amount", amount, "The value is not a decimal number"}
+    }
+    return round_rat(r.Mul(r, big.NewRat(100, 1)))
+}
+
+// Float64 returns the amount as a float number.
+func (m Money) Float64() float64 {
+    return float64(m) / 100
+}
+
+// String returns the decimal representation of the amount with 2 decimals.
+func (m Money) String() string {
+    sign := ""
+    cents := int64(m)
+    if cents < 0 {
+        sign = "-"
+        cents = -cents
+    }
+    return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Mul returns the amount multiplied by the factor, rounded to the cent. It
+// panics with a ValueError when the product doesn't fit in Money.
+func (m Money) Mul(factor float64) Money {
+    r := decimal_rat(factor)
+    if r == nil {
+        return 0
+    }
+    return must_round_rat(r.Mul(r, new(big.Rat).SetInt64(int64(m))))
+}
+
+// Div returns the amount divided by the divisor, rounded to the cent. The
+// division by 0 returns 0, and it panics with a ValueError when the quotient
+// doesn't fit in Money.
+func (m Money) Div(divisor float64) Money {
+    r := decimal_rat(divisor)
+    if r == nil || r.Sign() == 0 {
+        return 0
+    }
+    return must_round_rat(r.Quo(new(big.Rat).SetInt64(int64(m)), r))
+}
+
+// Ratio returns the amount divided by the other amount. The division by 0
+// returns 0.
+func (m Money) Ratio(other Money) float64 {
+    if other == 0 {
+        return 0
+    }
+    return float64(m) / float64(other)
+}
+
+// Floor returns the amount rounded down to the unit, for example Dollar.
+func (m Money) Floor(unit Money) Money {
+    floor := m / unit * unit
+    if floor > m {
+        floor -= unit
+    }
+    return floor
+}
+
+// Abs returns the absolute value of the amount.
+func (m Money) Abs() Money {
+    if m < 0 {
+        return -m
+    }
+    return m
+}
+
+// MarshalJSON returns the amount as a JSON number with 2 decimals.
+func (m Money) MarshalJSON() ([]byte, error) {
+    return []byte(m.String()), nil
+}
+
+// UnmarshalJSON parses the amount from a JSON number or string without going
+// through a float number.
+func (m *Money) UnmarshalJSON(data []byte) error {
+    if string(data) == "null" {
+        return nil
+    }
+    amount := string(data)
+    if len(data) > 0 && data[0] == '"' {
+        var value string
+        err := json.Unmarshal(data, &value)
+        if err != nil {
+            return err
+        }
+        amount = value
+    }
+    if _, err := strconv.ParseFloat(amount, 64); err != nil {
+        return &ValueError{"amount", amount, "The value is not a decimal number"}
+    }
+    parsed, err := ParseMoney(amount)
+    if err != nil {
+        return err
+    }
+    *m = parsed
+    return nil
+}
+
+// MoneyToFloat64 returns the amounts as float numbers.
+func MoneyToFloat64(amounts []Money) []float64 {
+    values := make([]float64, len(amounts))
+    for i, amount := range amounts {
+        values[i] = amount.Float64()
+    }
+    return values
+}
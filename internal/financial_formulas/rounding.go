@@ -0,0 +1,133 @@
+// Rounding policies. Lenders round their schedules in different ways, so the
+// formulas can be calculated with a rounding policy that says how the halves
+// are rounded, when the amounts are rounded and to which precision. The
+// package functions use the DefaultRounding policy.
+
+package financial_formulas
+
+import (
+    "math/big";
+)
+
+// Rounding modes
+const (
+    // RoundHalfUp rounds the halves away from zero, like math.Round.
+    RoundHalfUp = iota
+    // RoundHalfEven rounds the halves to the even number, banker's rounding.
+    RoundHalfEven
+)
+
+// Rounding scopes
+const (
+    // RoundEachStep rounds the payment and every interest and principal
+    // payment while the schedule is calculated.
+    RoundEachStep = iota
+    // RoundPaymentOnly rounds the payment, while the interest and the balance
+    // are carried without rounding.
+    RoundPaymentOnly
+    // RoundOnOutput carries every amount without rounding and only rounds the
+    // amounts that are returned.
+    RoundOnOutput
+)
+
+// RoundingPolicy says how the currency amounts are rounded. The precision is
+// the increment the amounts are rounded to, a Cent when it is not set.
+type RoundingPolicy struct {
+    Mode        int     `json:"mode"`
+    Scope       int     `json:"scope"`
+    Precision   Money   `json:"precision"`
+}
+
+// DefaultRounding rounds half up to the cent at each step.
+var DefaultRounding = RoundingPolicy{
+    Mode: RoundHalfUp,
+    Scope: RoundEachStep,
+    Precision: Cent,
+}
+
+// Validate checks that the rounding policy is one of the supported ones.
+func (rp RoundingPolicy) Validate() error {
+    if rp.Mode != RoundHalfUp && rp.Mode != RoundHalfEven {
+        return &ValidationError{"mode", rp.Mode, "The value must be 0 (RoundHalfUp) or 1 (RoundHalfEven)"}
+    }
+    if rp.Scope != RoundEachStep && rp.Scope != RoundPaymentOnly && rp.Scope != RoundOnOutput {
+        return &ValidationError{"scope", rp.Scope, "The value must be 0 (RoundEachStep), 1 (RoundPaymentOnly) or 2 (RoundOnOutput)"}
+    }
+    if rp.Precision < 0 {
+        return &ValidationError{"precision", rp.Precision, "The value must be 0 (a cent) or greater"}
+    }
+    return nil
+}
+
+// increment returns the precision of the policy in cents.
+func (rp RoundingPolicy) increment() *big.Rat {
+    if rp.Precision <= 0 {
+        return big.NewRat(int64(Cent), 1)
+    }
+    return big.NewRat(int64(rp.Precision), 1)
+}
+
+// round_int returns the rational rounded to an integer with the mode.
+func round_int(r *big.Rat, mode int) *big.Int {
+    quotient, remainder := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+    // comparing 2 * |remainder| with the denominator tells if the fraction is
+    // more, less or exactly a half.
+    remainder.Abs(remainder).Lsh(remainder, 1)
+    half := remainder.Cmp(r.Denom())
+    if half > 0 || (half == 0 && (mode == RoundHalfUp || quotient.Bit(0) == 1)) {
+        quotient.Add(quotient, big.NewInt(int64(r.Sign())))
+    }
+    return quotient
+}
+
+// round_cents returns the amount in cents rounded to the precision of the
+// policy.
+func (rp RoundingPolicy) round_cents(cents *big.Rat) *big.Rat {
+    increment := rp.increment()
+    steps := round_int(new(big.Rat).Quo(cents, increment), rp.Mode)
+    return new(big.Rat).Mul(new(big.Rat).SetInt(steps), increment)
+}
+
+// step returns the amount in cents rounded when the policy rounds at each
+// step, or the amount without rounding otherwise.
+func (rp RoundingPolicy) step(cents *big.Rat) *big.Rat {
+    if rp.Scope == RoundEachStep {
+        return rp.round_cents(cents)
+    }
+    return cents
+}
+
+// payment_step returns the payment in cents rounded when the policy rounds
+// the payment, or the payment without rounding otherwise.
+func (rp RoundingPolicy) payment_step(cents *big.Rat) *big.Rat {
+    if rp.Scope == RoundOnOutput {
+        return cents
+    }
+    return rp.round_cents(cents)
+}
+
+// money returns the amount in cents rounded to the precision of the policy,
+// or a ValueError when it doesn't fit in Money.
+func (rp RoundingPolicy) money(cents *big.Rat) (Money, error) {
+    return int_money(rp.round_cents(cents).Num())
+}
+
+// Round returns a float amount rounded to the precision of the policy.
+func (rp RoundingPolicy) Round(num float64) float64 {
+    cents := decimal_rat(num)
+    if cents == nil {
+        return num
+    }
+    rounded, _ := rp.round_cents(cents.Mul(cents, big.NewRat(int64(Dollar), 1))).Float64()
+    return rounded / float64(Dollar)
+}
+
+// Money returns a float amount as Money rounded to the precision of the
+// policy, or a ValueError when it doesn't fit in Money.
+func (rp RoundingPolicy) Money(num float64) (Money, error) {
+    cents := decimal_rat(num)
+    if cents == nil {
+        return 0, &ValueError{"amount", num, "The value must be a finite number"}
+    }
+    return rp.money(cents.Mul(cents, big.NewRat(int64(Dollar), 1)))
+}
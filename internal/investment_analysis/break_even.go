@@ -0,0 +1,315 @@
+// Break-even thresholds of a deal, the margins of safety asked for by the
+// lenders and the investment committee. The occupancy and the revenue decline
+// are read from the projection, since the cash flows move linearly with the
+// revenue, while the exit cap rate and the interest rate are searched by
+// bisection over the projection and the loan schedule.
+
+package investment_analysis
+
+import (
+    "fmt";
+    "math";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+)
+
+// BREAK_EVEN_PRECISION of the rates searched by bisection.
+const BREAK_EVEN_PRECISION = 0.000001
+
+// BreakEven has the break-even thresholds of the deal. The target exit cap
+// rate is only solved with a target IRR. The thresholds that can't be solved
+// have their error by their JSON name.
+type BreakEven struct {
+    Occupancy               []float64           `json:"break_even_occupancy"`
+    ExitCapRate             float64             `json:"break_even_exit_cap_rate"`
+    TargetExitCapRate       float64             `json:"target_exit_cap_rate,omitempty"`
+    MaximumInterestRate     float64             `json:"maximum_interest_rate"`
+    MaximumRevenueDecline   float64             `json:"maximum_revenue_decline"`
+    Errors                  map[string]string   `json:"errors,omitempty"`
+}
+
+// operating_years returns the years of the projection, without the
+// adquisition.
+func (roi ReturnOfInvestment) operating_years () ([]map[string]interface{}, error) {
+    if len(roi.NetCashFlowProjection) <= 1 {
+        return nil, &ff.ValidationError{Field: "net_cash_flow_projection", Value: roi.NetCashFlowProjection, Message: "The projection of the deal must be set"}
+    }
+    return roi.NetCashFlowProjection[1:], nil
+}
+
+// rent_terms returns the rent of the year of the projection, that is the
+// revenue without the other income, the other income and the management fee
+// as a fraction of the revenue. The rent moves with the occupancy, the other
+// income doesn't, and the management fee moves with the revenue. Without an
+// operating statement the whole revenue is rent, without a management fee.
+func (roi ReturnOfInvestment) rent_terms (i int, year map[string]interface{}) (ff.Money, ff.Money, float64, error) {
+    revenue := year["revenue"].(ff.Money)
+    if i >= len(roi.OperatingStatement) {
+        return revenue, 0, 0.0, nil
+    }
+    statement := roi.OperatingStatement[i]
+    fee_rate := 0.0
+    if statement.EffectiveGrossIncome > 0 {
+        fee_rate = statement.ManagementFee.Ratio(statement.EffectiveGrossIncome)
+    }
+    if fee_rate >= 1 {
+        return 0, 0, 0.0, &ff.ValueError{Field: "management_fee", Value: fee_rate, Message: fmt.Sprintf("The management fee of the year %d must be less than the revenue", i + 1)}
+    }
+    return revenue - statement.OtherIncome, statement.OtherIncome, fee_rate, nil
+}
+
+// BreakEvenOccupancy returns the occupancy of every year of the projection at
+// which the NOI covers the debt service and the reserves set aside. The rent
+// at the occupancy, the other income less the management fee of both, has to
+// cover the other expenses, the debt service and the reserves. With an
+// operating statement the potential rent is the rent before the vacancy, the
+// concessions and the credit loss, otherwise it is the revenue of the
+// projection.
+func (roi ReturnOfInvestment) BreakEvenOccupancy () ([]float64, error) {
+    years, err := roi.operating_years()
+    if err != nil {
+        return nil, err
+    }
+    occupancy := make([]float64, len(years))
+    for i, year := range years {
+        potential_rent, other_income, fee_rate, err := roi.rent_terms(i, year)
+        if err != nil {
+            return nil, err
+        }
+        costs := year["expense"].(ff.Money) -
+            year["principal_payment"].(ff.Money) -
+            year["interest_payment"].(ff.Money) +
+            year["reserve"].(ff.Money).Abs()
+        if i < len(roi.OperatingStatement) {
+            statement := roi.OperatingStatement[i]
+            potential_rent += statement.Vacancy + statement.Concessions + statement.CreditLoss
+            costs -= statement.ManagementFee
+        }
+        if potential_rent <= 0 {
+            return nil, &ff.ValueError{Field: "revenue", Value: potential_rent, Message: fmt.Sprintf("The potential rent of the year %d must be greater than 0", i + 1)}
+        }
+        // the revenue needed before the management fee, covered first by the
+        // other income.
+        needed_rent := costs.Div(1 - fee_rate) - other_income
+        occupancy[i] = ff.Round4(needed_rent.Ratio(potential_rent))
+    }
+    return occupancy, nil
+}
+
+// irr_at_exit_cap_rate returns the IRR of the deal sold at the exit cap rate.
+func (roi ReturnOfInvestment) irr_at_exit_cap_rate (exit_cap_rate float64) (float64, error) {
+    sale := roi.saleMetrics
+    sale.ExitCapRate = exit_cap_rate
+    candidate := NewReturnOfInvestment(roi.taxMetrics, roi.dealMetrics, roi.loanMetrics, sale)
+    candidate.SetAdquisitionCost()
+    err := candidate.SetNetCashFlowProjection()
+    if err != nil {
+        return 0.0, fmt.Errorf("SetNetCashFlowProjection internal error: %w", err)
+    }
+    return candidate.levered_irr()
+}
+
+// ExitCapRateForIRR returns the exit cap rate at which the IRR of the deal is
+// the target IRR. A higher exit cap rate gives a lower IRR.
+func (roi ReturnOfInvestment) ExitCapRateForIRR (target_irr float64) (float64, error) {
+    if roi.saleMetrics.ExitCapRate <= 0 {
+        return 0.0, &ff.ValidationError{Field: "exit_cap_rate", Value: roi.saleMetrics.ExitCapRate, Message: "The value must be greater than 0"}
+    }
+    meets := func (exit_cap_rate float64) (bool, error) {
+        irr, err := roi.irr_at_exit_cap_rate(exit_cap_rate)
+        if err != nil {
+            return false, err
+        }
+        return irr >= target_irr, nil
+    }
+
+    // bracketing the rate between a rate that meets the target and one that
+    // doesn't, starting at the exit cap rate of the deal.
+    low, high := roi.saleMetrics.ExitCapRate, roi.saleMetrics.ExitCapRate
+    met, err := meets(low)
+    if err != nil {
+        return 0.0, err
+    }
+    for met {
+        if high >= 1 {
+            return 0.0, &ff.ValueError{Field: "exit_cap_rate", Value: high, Message: "The target IRR is met at any exit cap rate"}
+        }
+        low = high
+        high = math.Min(high * 2, 1)
+        met, err = meets(high)
+        if err != nil {
+            return 0.0, err
+        }
+    }
+    if low == high {
+        for !met {
+            high = low
+            low /= 2
+            if low < BREAK_EVEN_PRECISION {
+                return 0.0, &ff.ValueError{Field: "exit_cap_rate", Value: low, Message: "The target IRR can't be met at any exit cap rate"}
+            }
+            met, err = meets(low)
+            if err != nil {
+                return 0.0, err
+            }
+        }
+    }
+
+    for high - low > BREAK_EVEN_PRECISION {
+        rate := (low + high) / 2
+        met, err = meets(rate)
+        if err != nil {
+            return 0.0, err
+        }
+        if met {
+            low = rate
+        } else {
+            high = rate
+        }
+    }
+    return ff.Round4(low), nil
+}
+
+// dscr_at_rate returns the lowest DSCR of the years of the projection with the
+// loan amount kept and the payments at the interest rate.
+func (roi ReturnOfInvestment) dscr_at_rate (rate float64, years []map[string]interface{}) (float64, error) {
+    loan := roi.loanMetrics
+    loan.Rate = rate
+    err := loan.SetIOLoanPayment()
+    if err != nil {
+        return 0.0, fmt.Errorf("SetIOLoanPayment internal error: %w", err)
+    }
+    err = loan.SetLoanPayment()
+    if err != nil {
+        return 0.0, fmt.Errorf("SetLoanPayment internal error: %w", err)
+    }
+    ppmt, ipmt, err := loan.PaymentDistribution()
+    if err != nil {
+        return 0.0, fmt.Errorf("PaymentDistribution internal error: %w", err)
+    }
+    lowest := math.Inf(1)
+    for i, year := range years {
+        if i >= len(ppmt) {
+            break
+        }
+        debt_service := ppmt[i] + ipmt[i]
+        if debt_service < 0 {
+            lowest = math.Min(lowest, year["noi"].(ff.Money).Ratio(- debt_service))
+        }
+    }
+    return lowest, nil
+}
+
+// MaximumInterestRate returns the highest interest rate of the loan at which
+// the DSCR of every year of the projection still meets the minimum DSCR of the
+// loan, keeping the loan amount.
+func (roi ReturnOfInvestment) MaximumInterestRate () (float64, error) {
+    years, err := roi.operating_years()
+    if err != nil {
+        return 0.0, err
+    }
+    if roi.loanMetrics.MinDSCR <= 0 {
+        return 0.0, &ff.ValidationError{Field: "min_dscr", Value: roi.loanMetrics.MinDSCR, Message: "The value must be greater than 0"}
+    }
+    if roi.loanMetrics.MaximumLoanAmount <= 0 {
+        return 0.0, &ff.ValidationError{Field: "maximum_loan_amount", Value: roi.loanMetrics.MaximumLoanAmount, Message: "The value must be greater than 0"}
+    }
+    meets := func (rate float64) (bool, error) {
+        dscr, err := roi.dscr_at_rate(rate, years)
+        if err != nil {
+            return false, err
+        }
+        return dscr >= roi.loanMetrics.MinDSCR, nil
+    }
+
+    // the payments only grow with the rate.
+    low, high := 0.0, 1.0
+    met, err := meets(low)
+    if err != nil {
+        return 0.0, err
+    }
+    if !met {
+        return 0.0, &ff.ValueError{Field: "rate", Value: low, Message: "The minimum DSCR can't be met at any interest rate"}
+    }
+    met, err = meets(high)
+    if err != nil {
+        return 0.0, err
+    }
+    if met {
+        return 0.0, &ff.ValueError{Field: "rate", Value: high, Message: "The minimum DSCR is met at any interest rate"}
+    }
+
+    for high - low > BREAK_EVEN_PRECISION {
+        rate := (low + high) / 2
+        met, err = meets(rate)
+        if err != nil {
+            return 0.0, err
+        }
+        if met {
+            low = rate
+        } else {
+            high = rate
+        }
+    }
+    return ff.Round4(low), nil
+}
+
+// MaximumRevenueDecline returns the highest fraction of the rent of every year
+// that can be lost before the cash flow after debt service of a year is
+// negative. Like with the break-even occupancy, the other income is kept and
+// the management fee falls with the revenue. A negative decline is the rent
+// growth needed to cover the cash flow of the worst year.
+func (roi ReturnOfInvestment) MaximumRevenueDecline () (float64, error) {
+    years, err := roi.operating_years()
+    if err != nil {
+        return 0.0, err
+    }
+    decline := math.Inf(1)
+    for i, year := range years {
+        rent, _, fee_rate, err := roi.rent_terms(i, year)
+        if err != nil {
+            return 0.0, err
+        }
+        // the cash flow lost with every dollar of rent.
+        net_rent := rent.Mul(1 - fee_rate)
+        if net_rent <= 0 {
+            return 0.0, &ff.ValueError{Field: "revenue", Value: rent, Message: fmt.Sprintf("The rent of the year %d must be greater than 0", i + 1)}
+        }
+        decline = math.Min(decline, year["cashflow_after_debt_service"].(ff.Money).Ratio(net_rent))
+    }
+    return ff.Round4(decline), nil
+}
+
+// BreakEven returns the break-even thresholds of the deal. The target exit cap
+// rate is solved when the target IRR is greater than 0. A threshold that can't
+// be solved keeps its error in the result, and the other thresholds are still
+// returned. The deal needs its projection.
+func (roi ReturnOfInvestment) BreakEven (target_irr float64) (BreakEven, error) {
+    _, err := roi.operating_years()
+    if err != nil {
+        return BreakEven{}, err
+    }
+    result := BreakEven{}
+    errors := map[string]string{}
+    keep := func (threshold string, err error) {
+        if err != nil {
+            errors[threshold] = err.Error()
+        }
+    }
+
+    result.Occupancy, err = roi.BreakEvenOccupancy()
+    keep("break_even_occupancy", err)
+    result.ExitCapRate, err = roi.ExitCapRateForIRR(0)
+    keep("break_even_exit_cap_rate", err)
+    if target_irr > 0 {
+        result.TargetExitCapRate, err = roi.ExitCapRateForIRR(target_irr)
+        keep("target_exit_cap_rate", err)
+    }
+    result.MaximumInterestRate, err = roi.MaximumInterestRate()
+    keep("maximum_interest_rate", err)
+    result.MaximumRevenueDecline, err = roi.MaximumRevenueDecline()
+    keep("maximum_revenue_decline", err)
+    if len(errors) > 0 {
+        result.Errors = errors
+    }
+    return result, nil
+}
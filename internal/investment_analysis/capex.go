@@ -0,0 +1,248 @@
+// Capital expenditure plan of a value-add deal. The renovations are spent on
+// their dates instead of at the closing, and every spend is funded by the
+// equity with the cash flow of its month, by a holdback of the loan proceeds or
+// by an upfront capex reserve. The holdback and the reserve are funded at the
+// closing and released when the work is done. The unit turns renovate a number
+// of units every month, and every renovated unit earns a rent premium from the
+// month after its renovation. The spend is capitalized in the tax basis.
+
+package investment_analysis
+
+import (
+    "math";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    "jacobitosuperstar/LoanSizing/internal/utils";
+)
+
+// Funding sources of the capital expenditures.
+const (
+    FundingEquity   = "equity"
+    FundingHoldback = "holdback"
+    FundingReserves = "reserves"
+)
+
+// UNIT_TURNS_CATEGORY is the category of the unit turns without one.
+const UNIT_TURNS_CATEGORY = "unit_turns"
+
+// CapexItem is a capital expenditure spent on a date.
+type CapexItem struct {
+    Category        string      `json:"category"`
+    Date            utils.Date  `json:"date"`
+    Amount          ff.Money    `json:"amount"`
+    Funding         string      `json:"funding"`
+}
+
+// UnitTurn is a schedule of unit renovations. Starting on the month of its
+// start date, UnitsPerMonth units are renovated every month until all the
+// units are done. The rent premium is monthly per renovated unit, and it grows
+// every year after the start date.
+type UnitTurn struct {
+    Category        string      `json:"category"`
+    StartDate       utils.Date  `json:"start_date"`
+    Units           int         `json:"units"`
+    UnitsPerMonth   int         `json:"units_per_month"`
+    CostPerUnit     ff.Money    `json:"cost_per_unit"`
+    RentPremium     ff.Money    `json:"rent_premium"`
+    PremiumGrowth   float64     `json:"premium_growth"`
+    Funding         string      `json:"funding"`
+}
+
+// CapexPlan has the capital expenditures and the unit turns of the deal, and
+// the date the projection starts.
+type CapexPlan struct {
+    StartDate       utils.Date  `json:"start_date"`
+    Items           []CapexItem `json:"items"`
+    UnitTurns       []UnitTurn  `json:"unit_turns"`
+}
+
+// CapexSummary is the spend of the plan during the term by category and by
+// funding source.
+type CapexSummary struct {
+    Categories      map[string]ff.Money `json:"categories"`
+    Equity          ff.Money            `json:"equity"`
+    Holdback        ff.Money            `json:"holdback"`
+    Reserves        ff.Money            `json:"reserves"`
+}
+
+// capex_projection has the monthly spend of the plan, the part of it released
+// from the holdback and the reserve, and the rent premium of the renovated
+// units.
+type capex_projection struct {
+    spend           []ff.Money
+    released        []ff.Money
+    rent_premium    []ff.Money
+    summary         CapexSummary
+}
+
+// IsSupplied returns if the plan has capital expenditures or unit turns.
+func (plan CapexPlan) IsSupplied () bool {
+    return len(plan.Items) > 0 || len(plan.UnitTurns) > 0
+}
+
+// validate_funding checks that the funding is one of the supported sources.
+func validate_funding (funding string) error {
+    switch funding {
+    case "", FundingEquity, FundingHoldback, FundingReserves:
+        return nil
+    }
+    return &ff.ValidationError{Field: "funding", Value: funding, Message: "The value must be equity, holdback or reserves"}
+}
+
+// Validate checks the start date, the capital expenditures and the unit turns
+// of the plan.
+func (plan CapexPlan) Validate () error {
+    if plan.StartDate.IsZero() {
+        return &ff.ValidationError{Field: "start_date", Value: plan.StartDate, Message: "The start date of the projection is needed with a capex plan"}
+    }
+    for _, item := range plan.Items {
+        if item.Date.IsZero() {
+            return &ff.ValidationError{Field: "date", Value: item, Message: "Every capital expenditure needs a date"}
+        }
+        if utils.MonthsBetween(plan.StartDate, item.Date) < 0 {
+            return &ff.ValidationError{Field: "date", Value: item.Date, Message: "The capital expenditures can't be before the start date"}
+        }
+        if item.Amount <= 0 {
+            return &ff.ValidationError{Field: "amount", Value: item.Amount, Message: "The value must be greater than 0"}
+        }
+        err := validate_funding(item.Funding)
+        if err != nil {
+            return err
+        }
+    }
+    for _, turn := range plan.UnitTurns {
+        if turn.StartDate.IsZero() {
+            return &ff.ValidationError{Field: "start_date", Value: turn, Message: "Every unit turn needs a start date"}
+        }
+        if utils.MonthsBetween(plan.StartDate, turn.StartDate) < 0 {
+            return &ff.ValidationError{Field: "start_date", Value: turn.StartDate, Message: "The unit turns can't start before the start date"}
+        }
+        if turn.Units <= 0 || turn.UnitsPerMonth <= 0 {
+            return &ff.ValidationError{Field: "units_per_month", Value: turn, Message: "The units and the units per month must be greater than 0"}
+        }
+        if turn.CostPerUnit < 0 || turn.RentPremium < 0 {
+            return &ff.ValidationError{Field: "cost_per_unit", Value: turn, Message: "The cost and the rent premium must be 0 or greater"}
+        }
+        if turn.PremiumGrowth <= -1 {
+            return &ff.ValidationError{Field: "premium_growth", Value: turn.PremiumGrowth, Message: "The value must be greater than -1"}
+        }
+        err := validate_funding(turn.Funding)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// add_spend adds a spend of a month of the projection. Only the spend during
+// the term is funded.
+func (cp *capex_projection) add_spend (month int, term_months int, amount ff.Money, category string, funding string) {
+    if month < 0 || month >= term_months || amount == 0 {
+        return
+    }
+    cp.spend[month] += amount
+    cp.summary.Categories[category] += amount
+    switch funding {
+    case FundingHoldback:
+        cp.released[month] += amount
+        cp.summary.Holdback += amount
+    case FundingReserves:
+        cp.released[month] += amount
+        cp.summary.Reserves += amount
+    default:
+        cp.summary.Equity += amount
+    }
+}
+
+// projection returns the monthly spend and rent premium of the plan for the
+// months of the projection, where only the first term months are funded and
+// renovate units.
+func (plan CapexPlan) projection (term_months int, months int) capex_projection {
+    cp := capex_projection{
+        spend: make([]ff.Money, months),
+        released: make([]ff.Money, months),
+        rent_premium: make([]ff.Money, months),
+        summary: CapexSummary{Categories: map[string]ff.Money{}},
+    }
+    if !plan.IsSupplied() {
+        return cp
+    }
+
+    for _, item := range plan.Items {
+        month := utils.MonthsBetween(plan.StartDate, item.Date)
+        cp.add_spend(month, term_months, item.Amount, item.Category, item.Funding)
+    }
+    for _, turn := range plan.UnitTurns {
+        category := turn.Category
+        if category == "" {
+            category = UNIT_TURNS_CATEGORY
+        }
+        first := utils.MonthsBetween(plan.StartDate, turn.StartDate)
+        renovated := 0
+        for m := min(first, 0); m < months; m++ {
+            // the units renovated before the month earn the premium.
+            if m >= 0 && renovated > 0 {
+                years := max(m - first, 0) / 12
+                cp.rent_premium[m] += turn.RentPremium.Mul(float64(renovated) * math.Pow(1 + turn.PremiumGrowth, float64(years)))
+            }
+            // only the units renovated during the term are paid for, so
+            // the turns stop at the sale.
+            if m >= first && m < term_months && renovated < turn.Units {
+                units := min(turn.UnitsPerMonth, turn.Units - renovated)
+                renovated += units
+                cp.add_spend(m, term_months, turn.CostPerUnit.Mul(float64(units)), category, turn.Funding)
+            }
+        }
+    }
+    return cp
+}
+
+// upfront_funding returns the holdback and the reserve of the plan funded at
+// the closing for the spend during the term.
+func (plan CapexPlan) upfront_funding (term_months int) (ff.Money, ff.Money) {
+    summary := plan.projection(term_months, term_months).summary
+    return summary.Holdback, summary.Reserves
+}
+
+// sum_years returns the monthly amounts added up by year.
+func sum_years (monthly []ff.Money) []ff.Money {
+    yearly := make([]ff.Money, (len(monthly) + MONTHS_PER_YEAR - 1) / MONTHS_PER_YEAR)
+    for m, amount := range monthly {
+        yearly[m / MONTHS_PER_YEAR] += amount
+    }
+    return yearly
+}
+
+// capex_projection returns the spend, the releases of the holdback and the
+// reserve and the rent premium of every period of the term and of the year
+// after it, with 1 or 12 periods per year.
+func (deal DealInformation) capex_projection (term int, periods_per_year int) (capex_projection, error) {
+    if deal.CapexPlan.IsSupplied() {
+        err := deal.CapexPlan.Validate()
+        if err != nil {
+            return capex_projection{}, err
+        }
+    }
+    cp := deal.CapexPlan.projection(term * MONTHS_PER_YEAR, (term + 1) * MONTHS_PER_YEAR)
+    if periods_per_year == 1 {
+        cp.spend = sum_years(cp.spend)
+        cp.released = sum_years(cp.released)
+        cp.rent_premium = sum_years(cp.rent_premium)
+    }
+    return cp, nil
+}
+
+// improvement_depreciation returns the depreciation of the capital
+// expenditures of every year of the term.
+func (roi ReturnOfInvestment) improvement_depreciation () ([]ff.Money, error) {
+    term_months := roi.loanMetrics.Term * MONTHS_PER_YEAR
+    spend := roi.dealMetrics.CapexPlan.projection(term_months, term_months).spend
+    return roi.taxMetrics.ImprovementDepreciation(spend, roi.loanMetrics.Term)
+}
+
+// validate_holdback checks that the loan can fund the holdback of the plan.
+func (roi ReturnOfInvestment) validate_holdback (summary CapexSummary) error {
+    if summary.Holdback > roi.loanMetrics.MaximumLoanAmount {
+        return &ff.ValidationError{Field: "holdback", Value: summary.Holdback, Message: "The holdback can't be greater than the maximum loan amount"}
+    }
+    return nil
+}
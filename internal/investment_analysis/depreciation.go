@@ -0,0 +1,223 @@
+// Depreciation of the building. The building can be depreciated straight-line
+// over a fixed timeline, or with the 27.5 years residential and 39 years
+// nonresidential recovery periods and the mid-month convention in the year it
+// is placed in service. A cost segregation study can move part of the building
+// to the 5, 7 and 15 years classes, that can take bonus depreciation.
+// The capital improvements are depreciated like the building from the month
+// they are spent.
+
+package investment_analysis
+
+import (
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+)
+
+// Depreciation methods of the building.
+const (
+    DepreciationStraightLine    = "straight_line"
+    DepreciationResidential     = "residential"
+    DepreciationNonresidential  = "nonresidential"
+)
+
+// Recovery periods in years of the building.
+const (
+    RESIDENTIAL_RECOVERY_YEARS      = 27.5
+    NONRESIDENTIAL_RECOVERY_YEARS   = 39.0
+)
+
+// MACRS rates of the 5 and 7 years classes (200% declining balance) and of the
+// 15 years class (150% declining balance), with the half-year convention.
+var (
+    macrs_5_year = []float64{0.2000, 0.3200, 0.1920, 0.1152, 0.1152, 0.0576}
+    macrs_7_year = []float64{0.1429, 0.2449, 0.1749, 0.1249, 0.0893, 0.0892, 0.0893, 0.0446}
+    macrs_15_year = []float64{
+        0.0500, 0.0950, 0.0855, 0.0770, 0.0693, 0.0623, 0.0590, 0.0590,
+        0.0591, 0.0590, 0.0591, 0.0590, 0.0591, 0.0590, 0.0591, 0.0295,
+    }
+)
+
+// CostSegregation has the fractions of the building value that a cost
+// segregation study moves to the shorter recovery classes.
+type CostSegregation struct {
+    FiveYear        float64     `json:"five_year"`
+    SevenYear       float64     `json:"seven_year"`
+    FifteenYear     float64     `json:"fifteen_year"`
+}
+
+// total returns the fraction of the building value in the shorter classes.
+func (cs CostSegregation) total () float64 {
+    return cs.FiveYear + cs.SevenYear + cs.FifteenYear
+}
+
+// validate_depreciation checks the depreciation method and its parameters.
+func (ta TaxAssumptions) validate_depreciation () error {
+    switch ta.DepreciationMethod {
+    case "", DepreciationStraightLine, DepreciationResidential, DepreciationNonresidential:
+    default:
+        return &ff.ValidationError{Field: "depreciation_method", Value: ta.DepreciationMethod, Message: "The value must be straight_line, residential or nonresidential"}
+    }
+    if ta.PlacedInServiceMonth < 0 || ta.PlacedInServiceMonth > 12 {
+        return &ff.ValidationError{Field: "placed_in_service_month", Value: ta.PlacedInServiceMonth, Message: "The value must be between 1 and 12, or 0 for January"}
+    }
+    cs := ta.CostSegregation
+    if cs.FiveYear < 0 || cs.SevenYear < 0 || cs.FifteenYear < 0 || cs.total() > 1 {
+        return &ff.ValidationError{Field: "cost_segregation", Value: cs, Message: "The fractions must be positive and add up to 1 or less"}
+    }
+    if ta.BonusDepreciation < 0 || ta.BonusDepreciation > 1 {
+        return &ff.ValidationError{Field: "bonus_depreciation", Value: ta.BonusDepreciation, Message: "The value must be between 0 and 1"}
+    }
+    return nil
+}
+
+// straight_line returns the yearly deductions of the basis over the recovery
+// years, where the first year only takes a fraction of a full year. Every
+// deduction is the difference of the rounded accumulated depreciation, so the
+// deductions always add up to the basis. Without recovery years there are no
+// deductions.
+func straight_line (basis ff.Money, recovery_years float64, first_year float64) []ff.Money {
+    var deductions []ff.Money
+    if recovery_years <= 0 {
+        return deductions
+    }
+    elapsed := first_year
+    taken := ff.Money(0)
+    for taken < basis {
+        accumulated := basis
+        if elapsed < recovery_years {
+            accumulated = basis.Mul(elapsed / recovery_years)
+        }
+        deductions = append(deductions, accumulated - taken)
+        taken = accumulated
+        elapsed += 1
+    }
+    return deductions
+}
+
+// macrs returns the yearly deductions of the basis with the rates of a MACRS
+// table. The last deduction takes what is left of the basis.
+func macrs (basis ff.Money, rates []float64) []ff.Money {
+    deductions := make([]ff.Money, len(rates))
+    remaining := basis
+    for i, rate := range rates {
+        deductions[i] = basis.Mul(rate)
+        if i == len(rates) - 1 {
+            deductions[i] = remaining
+        }
+        remaining -= deductions[i]
+    }
+    return deductions
+}
+
+// add_deductions adds the deductions to the yearly depreciation.
+func add_deductions (depreciation []ff.Money, deductions []ff.Money) {
+    for i := 0; i < len(depreciation) && i < len(deductions); i++ {
+        depreciation[i] -= deductions[i]
+    }
+}
+
+// add_personal_property adds the deductions of the cost segregated classes to
+// the yearly depreciation, and returns the basis left in the building. The
+// bonus depreciation is taken in the first year, and the rest of the classes
+// follows the MACRS tables.
+func (ta TaxAssumptions) add_personal_property (depreciation []ff.Money, building_value ff.Money) ff.Money {
+    cs := ta.CostSegregation
+    classes := []struct {
+        fraction    float64
+        rates       []float64
+    }{
+        {cs.FiveYear, macrs_5_year},
+        {cs.SevenYear, macrs_7_year},
+        {cs.FifteenYear, macrs_15_year},
+    }
+    building_basis := building_value
+    for _, class := range classes {
+        basis := building_value.Mul(class.fraction)
+        building_basis -= basis
+        bonus := basis.Mul(ta.BonusDepreciation)
+        add_deductions(depreciation, []ff.Money{bonus})
+        add_deductions(depreciation, macrs(basis - bonus, class.rates))
+    }
+    return building_basis
+}
+
+// PersonalPropertyDepreciation returns the depreciation expense of the cost
+// segregated classes for every year of the projection, negative like the
+// other expenses. The classes are section 1245 property, so at the sale their
+// depreciation is recaptured as ordinary income.
+func (ta TaxAssumptions) PersonalPropertyDepreciation (building_value ff.Money, years int) ([]ff.Money, error) {
+    err := ta.validate_depreciation()
+    if err != nil {
+        return nil, err
+    }
+    depreciation := make([]ff.Money, years)
+    ta.add_personal_property(depreciation, building_value)
+    return depreciation, nil
+}
+
+// DepreciationSchedule returns the depreciation expense of the building for
+// every year of the projection, negative like the other expenses of the
+// projection, with the depreciation of the cost segregated classes.
+func (ta TaxAssumptions) DepreciationSchedule (building_value ff.Money, years int) ([]ff.Money, error) {
+    err := ta.validate_depreciation()
+    if err != nil {
+        return nil, err
+    }
+    depreciation := make([]ff.Money, years)
+    building_basis := ta.add_personal_property(depreciation, building_value)
+
+    month := ta.PlacedInServiceMonth
+    if month == 0 {
+        month = 1
+    }
+    // with the mid-month convention the building is placed in service in the
+    // middle of the month.
+    first_year := (12 - float64(month) + 0.5) / 12
+    switch ta.DepreciationMethod {
+    case DepreciationResidential:
+        add_deductions(depreciation, straight_line(building_basis, RESIDENTIAL_RECOVERY_YEARS, first_year))
+    case DepreciationNonresidential:
+        add_deductions(depreciation, straight_line(building_basis, NONRESIDENTIAL_RECOVERY_YEARS, first_year))
+    default:
+        add_deductions(depreciation, straight_line(building_basis, float64(ta.FixDepreciationTimeLine), 1))
+    }
+    return depreciation, nil
+}
+
+// ImprovementDepreciation returns the depreciation expense of the capital
+// improvements spent every month for every year of the projection, negative
+// like the other expenses. Every improvement is depreciated like the building
+// from the month it is spent, without cost segregation or bonus depreciation.
+// The first month of the projection is the month the building is placed in
+// service.
+func (ta TaxAssumptions) ImprovementDepreciation (monthly_spend []ff.Money, years int) ([]ff.Money, error) {
+    err := ta.validate_depreciation()
+    if err != nil {
+        return nil, err
+    }
+    depreciation := make([]ff.Money, years)
+    // the projection starts in the month the building is placed in service,
+    // so the months are counted from January of its first tax year.
+    start := ta.PlacedInServiceMonth - 1
+    if start < 0 {
+        start = 0
+    }
+    for m, spend := range monthly_spend {
+        year := (start + m) / 12
+        if spend == 0 || year >= years {
+            continue
+        }
+        month := (start + m) % 12 + 1
+        first_year := (12 - float64(month) + 0.5) / 12
+        var deductions []ff.Money
+        switch ta.DepreciationMethod {
+        case DepreciationResidential:
+            deductions = straight_line(spend, RESIDENTIAL_RECOVERY_YEARS, first_year)
+        case DepreciationNonresidential:
+            deductions = straight_line(spend, NONRESIDENTIAL_RECOVERY_YEARS, first_year)
+        default:
+            deductions = straight_line(spend, float64(ta.FixDepreciationTimeLine), 1)
+        }
+        add_deductions(depreciation[year:], deductions)
+    }
+    return depreciation, nil
+}
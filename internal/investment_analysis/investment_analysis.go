@@ -17,28 +17,80 @@ import (
     ls "jacobitosuperstar/LoanSizing/internal/loan_sizer";
 )
 
+// Tax modes of the losses of the property.
+const (
+    // TaxModePassiveLoss suspends the losses and carries them forward against
+    // the future taxable income of the property, releasing them at the sale.
+    TaxModePassiveLoss  = "passive_loss"
+    // TaxModeOffsetIncome offsets the losses against other income of the
+    // investor without the passive loss limits, so a loss is a tax saving in
+    // the year. It is the mode used when no tax mode is given.
+    TaxModeOffsetIncome = "offset_income"
+)
+
 // TaxAssumptions is a struct that has all the taxes information regarding the
-// deal.
+// deal. The depreciation method is straight-line over the fixed timeline
+// unless another method is selected, and the losses offset other income unless
+// they are passive.
 type TaxAssumptions struct {
-    LanBuildingValue                float64     `json:"lan_building_value"`
-    FixDepreciationTimeLine         int         `json:"fixed_depreciation_timeline"`
-    IncomeTaxRate                   float64     `json:"income_tax_rate"`
-    CapitalGainsTaxRate             float64     `json:"capital_gains_tax_rate"`
-    DepreciationRecaptureTaxRate    float64     `json:"depreciation_recapture_tax_rate"`
+    TaxMode                         string          `json:"tax_mode"`
+    LanBuildingValue                float64         `json:"lan_building_value"`
+    FixDepreciationTimeLine         int             `json:"fixed_depreciation_timeline"`
+    DepreciationMethod              string          `json:"depreciation_method"`
+    PlacedInServiceMonth            int             `json:"placed_in_service_month"`
+    CostSegregation                 CostSegregation `json:"cost_segregation"`
+    BonusDepreciation               float64         `json:"bonus_depreciation"`
+    IncomeTaxRate                   float64         `json:"income_tax_rate"`
+    CapitalGainsTaxRate             float64         `json:"capital_gains_tax_rate"`
+    DepreciationRecaptureTaxRate    float64         `json:"depreciation_recapture_tax_rate"`
+}
+
+// validate_tax_mode checks that the tax mode is one of the supported ones.
+func (ta TaxAssumptions) validate_tax_mode () error {
+    if ta.TaxMode != "" && ta.TaxMode != TaxModePassiveLoss && ta.TaxMode != TaxModeOffsetIncome {
+        return &ff.ValidationError{Field: "tax_mode", Value: ta.TaxMode, Message: "The value must be passive_loss or offset_income"}
+    }
+    return nil
+}
+
+// IncomeTax returns the income tax of a year, negative when it is paid, and
+// the passive loss carried forward to the next year. With passive losses the
+// tax is never a refund, the loss is added to the carryforward and the
+// carryforward is used against the taxable income of the next years. Without
+// a tax mode the losses offset other income.
+func (ta TaxAssumptions) IncomeTax (taxable_income ff.Money, carryforward ff.Money) (ff.Money, ff.Money) {
+    if ta.TaxMode != TaxModePassiveLoss {
+        return - taxable_income.Mul(ta.IncomeTaxRate), carryforward
+    }
+    if taxable_income <= 0 {
+        return 0, carryforward - taxable_income
+    }
+    used := carryforward
+    if used > taxable_income {
+        used = taxable_income
+    }
+    return - (taxable_income - used).Mul(ta.IncomeTaxRate), carryforward - used
 }
 
 // DealInformation is a struct that has all the information regarding the
-// buying of the commercial property.
+// buying of the commercial property. When a rent roll is supplied the revenue
+// comes from its leases instead of the initial revenue and its growth, and
+// when an operating statement is supplied the revenue and the expenses come
+// from its lines. The renovations of a capex plan are spent during the term
+// instead of with the closing.
 type DealInformation struct {
-    PurchasePrice               int         `json:"purchase_price"`
-    ClosingAndRenovations       int         `json:"closing_and_renovations"`
+    PurchasePrice               ff.Money    `json:"purchase_price"`
+    ClosingAndRenovations       ff.Money    `json:"closing_and_renovations"`
     GoingInCapRate              float64     `json:"going_in_caprate"`
-    InitRevenue                 float64     `json:"initial_revenue"`
-    InitOperatingExpenses       float64     `json:"initial_operating_expenses"`
-    InitCapitalReserves         float64     `json:"initial_capital_reserves"`
+    InitRevenue                 ff.Money    `json:"initial_revenue"`
+    InitOperatingExpenses       ff.Money    `json:"initial_operating_expenses"`
+    InitCapitalReserves         ff.Money    `json:"initial_capital_reserves"`
     ProjRevenueGrowth           float64     `json:"projected_revenue_growth"`
     ProjOperatingExpensesGrowth float64     `json:"projected_operating_expenses_growth"`
     ProjCapitalReservesGrowth   float64     `json:"projected_capital_reserves_growth"`
+    RentRoll                    RentRoll            `json:"rent_roll"`
+    OperatingStatement          OperatingStatement  `json:"operating_statement"`
+    CapexPlan                   CapexPlan           `json:"capex_plan"`
 }
 
 // SaleTerms is a struc that has all the sale information regarding the sale of
@@ -50,10 +102,10 @@ type SaleTerms struct {
 }
 
 // ProjectedSalePrice returns the projected sale price of real state.
-func (st SaleTerms) ProjectedSalePrice (noi float64) float64 {
-    projected_sale_price := ff.Round2(noi / st.ExitCapRate)
-    projected_sale_price = projected_sale_price - (projected_sale_price * st.CostOfSale)
-    return ff.Round2(projected_sale_price)
+func (st SaleTerms) ProjectedSalePrice (noi ff.Money) ff.Money {
+    projected_sale_price := noi.Div(st.ExitCapRate)
+    projected_sale_price = projected_sale_price - projected_sale_price.Mul(st.CostOfSale)
+    return projected_sale_price
 }
 
 // ROI of the totallity of the deal.
@@ -63,164 +115,398 @@ type ReturnOfInvestment struct {
     loanMetrics             ls.LoanSizer
     saleMetrics             SaleTerms
     // Calculated fields
-    AdquisitionCost         float64                     `json:"adquisition_cost"`
+    AdquisitionCost         ff.Money                    `json:"adquisition_cost"`
     NetCashFlowProjection   []map[string]interface{}    `json:"net_cash_flow_projection"`
+    MonthlyCashFlowProjection []map[string]interface{}  `json:"monthly_cash_flow_projection,omitempty"`
+    OperatingStatement      []OperatingYear             `json:"operating_statement,omitempty"`
+    TaxBasis                TaxBasis                    `json:"tax_basis"`
+    SaleGain                SaleGain                    `json:"sale_gain"`
+    Capex                   CapexSummary                `json:"capex"`
     IRR                     float64                     `json:"internal_rate_of_return"`
     EquityMultiple          float64                     `json:"equity_multiple"`
     AverageCashOnCashReturn float64                     `json:"average_cash_on_cash_return"`
 }
 
+// NewReturnOfInvestment returns a ReturnOfInvestment with the metrics of the
+// deal. The loan must be already sized.
+func NewReturnOfInvestment (
+    taxMetrics TaxAssumptions,
+    dealMetrics DealInformation,
+    loanMetrics ls.LoanSizer,
+    saleMetrics SaleTerms,
+) ReturnOfInvestment {
+    return ReturnOfInvestment{
+        taxMetrics: taxMetrics,
+        dealMetrics: dealMetrics,
+        loanMetrics: loanMetrics,
+        saleMetrics: saleMetrics,
+    }
+}
+
 // SetAdquisitionCost sets the AdquisitionCost of Deal
 func (roi *ReturnOfInvestment) SetAdquisitionCost ()  {
-    adquisitionCost := - float64(roi.dealMetrics.PurchasePrice) -
-    float64(roi.dealMetrics.ClosingAndRenovations) -
-    (roi.loanMetrics.LoanOriginationFees * roi.loanMetrics.MaximumLoanAmount) +
+    adquisitionCost := - roi.dealMetrics.PurchasePrice -
+    roi.dealMetrics.ClosingAndRenovations -
+    roi.loanMetrics.MaximumLoanAmount.Mul(roi.loanMetrics.LoanOriginationFees) +
     roi.loanMetrics.MaximumLoanAmount
+    // the holdback and the capex reserve are funded at the closing.
+    holdback, reserves := roi.dealMetrics.CapexPlan.upfront_funding(roi.loanMetrics.Term * MONTHS_PER_YEAR)
+    adquisitionCost -= holdback + reserves
     roi.AdquisitionCost = adquisitionCost
 }
 
 // CashOnCashReturn returns the made money in reference to the money invested
 // to adquire the property.
-func (roi ReturnOfInvestment) CashOnCashReturn (net_cash_flow float64)  float64 {
-    return ff.Round4(math.Abs(net_cash_flow/roi.AdquisitionCost))
+func (roi ReturnOfInvestment) CashOnCashReturn (net_cash_flow ff.Money)  float64 {
+    return ff.Round4(math.Abs(net_cash_flow.Ratio(roi.AdquisitionCost)))
 }
 
-// SetNetCashFlowProjection sets the NetCashFlowProjection of the Deal
-func (roi *ReturnOfInvestment) SetNetCashFlowProjection () error {
-    var net_cash_flow_projection []map[string]interface{}
-    net_cash_flow_projection = append(
-        net_cash_flow_projection,
-        map[string]interface{} {
-            "net_cash_flow": roi.AdquisitionCost,
-        },
-    )
-
-    revenue := roi.dealMetrics.InitRevenue
-    expense := roi.dealMetrics.InitOperatingExpenses
-    reserve := roi.dealMetrics.InitCapitalReserves
+// cash_flow_projection returns the cash flow projection of the Deal with 1 or
+// 12 periods per year, starting with the adquisition, and sets the tax basis,
+// the sale gain and the capex of the Deal. The property is sold in the last
+// period of the term with the NOI of the year after the term, and the balloon
+// is the balance left by the payments of the loan.
+func (roi *ReturnOfInvestment) cash_flow_projection (periods_per_year int) ([]map[string]interface{}, error) {
+    projection := []map[string]interface{}{
+        {"net_cash_flow": roi.AdquisitionCost},
+    }
+
+    // the revenue and the expenses of the term and of the year after the
+    // sale.
+    periods := roi.loanMetrics.Term * periods_per_year
+    revenues, expenses, leasing_costs, err := roi.dealMetrics.operating_projection(periods + periods_per_year, periods_per_year)
+    if err != nil {
+        return nil, fmt.Errorf("operating_projection internal error: %w", err)
+    }
+    // the capital expenditures of the term and the rent premium of the
+    // renovated units.
+    capex, err := roi.dealMetrics.capex_projection(roi.loanMetrics.Term, periods_per_year)
+    if err != nil {
+        return nil, fmt.Errorf("capex_projection internal error: %w", err)
+    }
+    err = roi.validate_holdback(capex.summary)
+    if err != nil {
+        return nil, err
+    }
+    reserve := roi.dealMetrics.InitCapitalReserves.Div(float64(periods_per_year))
+    reserve_growth, err := ff.EffectiveRate(roi.dealMetrics.ProjCapitalReservesGrowth).Periodic(periods_per_year)
+    if err != nil {
+        return nil, fmt.Errorf("Periodic internal error: %v", err)
+    }
 
     // getting the building value
     purchase_price := roi.dealMetrics.PurchasePrice
-    building_value := ff.Round2(float64(purchase_price) * (1.0 - roi.taxMetrics.LanBuildingValue))
+    building_value := purchase_price.Mul(1.0 - roi.taxMetrics.LanBuildingValue)
 
     // depreciation of the building
-    building_depreciation := ff.Round2(- building_value/float64(roi.taxMetrics.FixDepreciationTimeLine))
+    err = roi.taxMetrics.validate_tax_mode()
+    if err != nil {
+        return nil, err
+    }
+    building_depreciation, err := roi.taxMetrics.DepreciationSchedule(building_value, roi.loanMetrics.Term)
+    if err != nil {
+        return nil, err
+    }
+    improvement_depreciation, err := roi.improvement_depreciation()
+    if err != nil {
+        return nil, err
+    }
+    for i := range building_depreciation {
+        building_depreciation[i] += improvement_depreciation[i]
+    }
+    // the cost segregated classes are taken out of the basis as section 1245
+    // property.
+    personal_property_depreciation, err := roi.taxMetrics.PersonalPropertyDepreciation(building_value, roi.loanMetrics.Term)
+    if err != nil {
+        return nil, err
+    }
+    if periods_per_year != 1 {
+        building_depreciation = spread_months(building_depreciation)
+        personal_property_depreciation = spread_months(personal_property_depreciation)
+    }
+    // the TI and the leasing commissions are amortized over the new leases.
+    leasing_amortization, err := roi.dealMetrics.leasing_amortization(periods, periods_per_year)
+    if err != nil {
+        return nil, fmt.Errorf("leasing_amortization internal error: %w", err)
+    }
+    passive_loss_carryforward := ff.Money(0)
+    // the closing costs and renovations are capitalized in the basis.
+    tax_basis := NewTaxBasis(purchase_price + roi.dealMetrics.ClosingAndRenovations)
 
-    // payment distribution of the loan
+    // payment distribution of the loan, with the payments in the periods they
+    // are paid.
     ppmt, ipmt, err := roi.loanMetrics.PaymentDistribution()
-
+    if periods_per_year != 1 {
+        ppmt, ipmt, err = roi.loanMetrics.MonthlyPaymentDistribution()
+    }
     if err != nil {
-        return fmt.Errorf("PaymentDistribution internal error: %v", err)
+        return nil, fmt.Errorf("PaymentDistribution internal error: %v", err)
     }
+    balance := roi.loanMetrics.MaximumLoanAmount
 
-    for i := 1; i <= roi.loanMetrics.Term; i++ {
-        // this year NOI
-        current_noi := ff.Round2(revenue - expense)
-        // this year interest and principal payments
+    for i := 1; i <= periods; i++ {
+        rent_premium := capex.rent_premium[i-1]
+        revenue := revenues[i-1] + rent_premium
+        expense := expenses[i-1]
+        // this period NOI
+        current_noi := revenue - expense
+        // this period interest and principal payments
         current_ppmt := ppmt[i-1]
         current_ipmt := ipmt[i-1]
-        current_pmt := roi.loanMetrics.LoanPayment
+        // the debt service follows the schedule, so the IO period and the
+        // years after the loan is paid off are taken into account.
+        current_pmt := current_ppmt + current_ipmt
+        balance += current_ppmt
+        // the TI and the leasing commissions are capitalized in the basis.
+        current_leasing_costs := leasing_costs[i-1]
+        tax_basis.AddImprovement(- current_leasing_costs)
+        // the capital expenditures are capitalized in the basis, and the
+        // holdback and the reserve funded at the closing are released.
+        capital_expenditures := - capex.spend[i-1]
+        capex_funding := capex.released[i-1]
+        tax_basis.AddImprovement(capex.spend[i-1])
         // cashflow after debt service
-        cfads := ff.Round2(current_noi + reserve + current_pmt)
-        // depreciation expense
-        depreciation_expense := 0.0
-        if i < roi.taxMetrics.FixDepreciationTimeLine {
-            depreciation_expense = building_depreciation
-        }
-        // income tax
-        income_tax := ff.Round2(- (current_noi + current_ipmt + depreciation_expense) * roi.taxMetrics.IncomeTaxRate)
-        implied_income_tax := ff.Round4(math.Abs(income_tax/cfads))
+        cfads := current_noi + reserve + current_pmt + current_leasing_costs + capital_expenditures + capex_funding
+        // depreciation expense, with the amortization of the leasing costs
+        depreciation_expense := building_depreciation[i-1] + leasing_amortization[i-1]
+        tax_basis.DepreciatePersonalProperty(- personal_property_depreciation[i-1])
+        tax_basis.Depreciate(personal_property_depreciation[i-1] - building_depreciation[i-1])
+        tax_basis.Amortize(- leasing_amortization[i-1])
+        // income tax, the passive losses of a period are carried to the next
+        // periods.
+        taxable_income := current_noi + current_ipmt + depreciation_expense
+        var income_tax ff.Money
+        income_tax, passive_loss_carryforward = roi.taxMetrics.IncomeTax(taxable_income, passive_loss_carryforward)
         // net cashflow
-        ncf := ff.Round2(cfads + income_tax)
-        // cash on cash return
-        cocr := roi.CashOnCashReturn(ncf)
-
-        net_cash_flow_projection = append(
-            net_cash_flow_projection,
-            map[string]interface{} {
-                "year": i,
-                "revenue": revenue,
-                "expense": expense,
-                "noi": current_noi,
-                "reserve": reserve,
-                "principal_payment": current_ppmt,
-                "interest_payment": current_ipmt,
-                "cashflow_after_debt_service": cfads,
-                "depreciation_expense": depreciation_expense,
-                "income_tax": income_tax,
-                "implied_income_tax": implied_income_tax,
-                "net_cash_flow": ncf,
-                "cash_on_cash_return": cocr,
-            },
-        )
-        revenue += ff.Round2(revenue * roi.dealMetrics.ProjRevenueGrowth)
-        expense += ff.Round2(expense * roi.dealMetrics.ProjOperatingExpensesGrowth)
-        reserve += ff.Round2(reserve * roi.dealMetrics.ProjCapitalReservesGrowth)
-    }
-    after_term_noi := ff.Round2(revenue + expense)
+        ncf := cfads + income_tax
+
+        period := map[string]interface{} {
+            "year": (i - 1) / periods_per_year + 1,
+            "revenue": revenue,
+            "rent_premium": rent_premium,
+            "expense": expense,
+            "noi": current_noi,
+            "reserve": reserve,
+            "leasing_costs": current_leasing_costs,
+            "capital_expenditures": capital_expenditures,
+            "capex_funding": capex_funding,
+            "principal_payment": current_ppmt,
+            "interest_payment": current_ipmt,
+            "cashflow_after_debt_service": cfads,
+            "depreciation_expense": depreciation_expense,
+            "adjusted_basis": tax_basis.Adjusted(),
+            "taxable_income": taxable_income,
+            "income_tax": income_tax,
+            "passive_loss_carryforward": passive_loss_carryforward,
+            "net_cash_flow": ncf,
+        }
+        if periods_per_year == 1 {
+            period["implied_income_tax"] = ff.Round4(math.Abs(income_tax.Ratio(cfads)))
+            // cash on cash return
+            period["cash_on_cash_return"] = roi.CashOnCashReturn(ncf)
+        } else {
+            period["month"] = i
+        }
+        projection = append(projection, period)
+        reserve += reserve.Mul(reserve_growth)
+    }
     // Adding the cashflow after the sell of the property
-    // sale with the projected NOI
+    // sale with the projected NOI of the year after the term
+    after_term_noi := ff.Money(0)
+    for p := periods; p < len(revenues); p++ {
+        after_term_noi += revenues[p] + capex.rent_premium[p] - expenses[p]
+    }
     projected_sale_price := roi.saleMetrics.ProjectedSalePrice(after_term_noi)
-    // capital gains tax
-    cg := projected_sale_price -
-        float64(roi.dealMetrics.PurchasePrice) -
-        float64(roi.dealMetrics.ClosingAndRenovations)
-    cg = ff.Round2(cg)
-    cgt := cg * roi.taxMetrics.CapitalGainsTaxRate
-    // Depreciation Recapture tax
-    drt := building_depreciation *
-        float64(roi.saleMetrics.SaleYear) *
-        roi.taxMetrics.DepreciationRecaptureTaxRate
-    drt = ff.Round2(drt)
+    // the gain over the adjusted basis is split in the depreciation recapture
+    // and the capital gain.
+    sale_gain := tax_basis.Sale(projected_sale_price, roi.taxMetrics)
+    drt := sale_gain.RecaptureTax
+    cgt := sale_gain.CapitalGainsTax
+    // the suspended passive losses are released with the sale, and they are
+    // deducted from the income of the investor.
+    released_loss_tax := passive_loss_carryforward.Mul(roi.taxMetrics.IncomeTaxRate)
     // Sale calculations
-    sale := net_cash_flow_projection[roi.loanMetrics.Term - 1]
-    sale_net_cash_flow := sale["net_cash_flow"].(float64)
+    // the balloon is the outstanding balance that is paid off with the sale.
+    sale := projection[periods]
+    sale_net_cash_flow := sale["net_cash_flow"].(ff.Money)
     sale_net_cash_flow = sale_net_cash_flow +
         projected_sale_price +
         drt +
         cgt +
-        roi.loanMetrics.BalloonPayment
-    sale_net_cash_flow = ff.Round2(sale_net_cash_flow)
+        released_loss_tax -
+        balance
     sale["net_cash_flow"] = sale_net_cash_flow
     sale["sale_price"] = projected_sale_price
+    sale["balloon_payment"] = balance
     sale["depreciation_recapture_tax"] = drt
     sale["capital_gains_tax"] = cgt
+    sale["total_gain"] = sale_gain.TotalGain
+    sale["unrecaptured_section_1250_gain"] = sale_gain.UnrecapturedGain
+    sale["capital_gain"] = sale_gain.CapitalGain
+    sale["released_passive_loss"] = passive_loss_carryforward
+    sale["released_passive_loss_tax"] = released_loss_tax
     // Setting the value
+    roi.TaxBasis = tax_basis
+    roi.SaleGain = sale_gain
+    roi.Capex = capex.summary
+    return projection, nil
+}
+
+// SetNetCashFlowProjection sets the NetCashFlowProjection of the Deal
+func (roi *ReturnOfInvestment) SetNetCashFlowProjection () error {
+    net_cash_flow_projection, err := roi.cash_flow_projection(1)
+    if err != nil {
+        return err
+    }
     roi.NetCashFlowProjection = net_cash_flow_projection
     return nil
 }
 
+// SetOperatingStatement sets the OperatingStatement of every year of the Deal
+// when the deal has one.
+func (roi *ReturnOfInvestment) SetOperatingStatement () error {
+    if !roi.dealMetrics.OperatingStatement.IsSupplied() {
+        roi.OperatingStatement = nil
+        return nil
+    }
+    statements, err := roi.dealMetrics.operating_statement(roi.loanMetrics.Term)
+    if err != nil {
+        return fmt.Errorf("operating_statement internal error: %w", err)
+    }
+    roi.OperatingStatement = statements
+    return nil
+}
+
+// net_cash_flows returns the net cash flow of every year of the projection,
+// starting with the adquisition.
+func (roi ReturnOfInvestment) net_cash_flows () []ff.Money {
+    net_cash_flows := make([]ff.Money, len(roi.NetCashFlowProjection))
+    for i, year := range roi.NetCashFlowProjection {
+        net_cash_flows[i] = year["net_cash_flow"].(ff.Money)
+    }
+    return net_cash_flows
+}
+
+// DebtServiceCoverage returns the debt service coverage ratio of every year of
+// the projection, that is the NOI over the debt service. A year without debt
+// service has a ratio of 0.
+func (roi ReturnOfInvestment) DebtServiceCoverage () []float64 {
+    var years []map[string]interface{}
+    if len(roi.NetCashFlowProjection) > 1 {
+        years = roi.NetCashFlowProjection[1:]
+    }
+    dscr := make([]float64, len(years))
+    for i, year := range years {
+        debt_service := year["principal_payment"].(ff.Money) + year["interest_payment"].(ff.Money)
+        if debt_service < 0 {
+            dscr[i] = ff.Round4(year["noi"].(ff.Money).Ratio(- debt_service))
+        }
+    }
+    return dscr
+}
+
+// levered_irr returns the levered internal rate of return of the projection
+// without rounding. A deal that doesn't return any cash after the adquisition
+// has an IRR of -1.
+func (roi ReturnOfInvestment) levered_irr () (float64, error) {
+    net_cash_flows := roi.net_cash_flows()
+    returned := ff.Money(0)
+    for _, net_cash_flow := range net_cash_flows[1:] {
+        returned += net_cash_flow
+    }
+    if returned <= 0 {
+        return -1, nil
+    }
+    irr, err := ff.InternalRateOfReturn(ff.MoneyToFloat64(net_cash_flows))
+    if err != nil {
+        return 0.0, fmt.Errorf("InternalRateOfReturn internal error: %v", err)
+    }
+    return irr, nil
+}
+
+// SetIRR sets the levered internal rate of return of the Deal, -1 when the
+// deal doesn't return any cash after the adquisition.
 func (roi *ReturnOfInvestment) SetIRR () error {
+    irr, err := roi.levered_irr()
+    if err != nil {
+        return err
+    }
+    roi.IRR = ff.Round4(irr)
     return nil
 }
 
+// SetEquityMultiple sets the equity multiple of the Deal, that is the net cash
+// flows received over the equity invested in the adquisition.
 func (roi *ReturnOfInvestment) SetEquityMultiple () error {
+    net_cash_flows := roi.net_cash_flows()
+    if len(net_cash_flows) == 0 || net_cash_flows[0] >= 0 {
+        return &ff.ValidationError{Field: "adquisition_cost", Value: roi.AdquisitionCost, Message: "The deal must need equity to calculate the equity multiple"}
+    }
+    received := ff.Money(0)
+    for _, net_cash_flow := range net_cash_flows[1:] {
+        received += net_cash_flow
+    }
+    roi.EquityMultiple = ff.Round4(- received.Ratio(net_cash_flows[0]))
     return nil
 }
 
+// SetAverageCashOnCashReturn sets the average of the yearly cash on cash
+// returns of the Deal.
 func (roi *ReturnOfInvestment) SetAverageCashOnCashReturn () error {
+    years := roi.NetCashFlowProjection[1:]
+    if len(years) == 0 {
+        roi.AverageCashOnCashReturn = 0
+        return nil
+    }
+    total := 0.0
+    for _, year := range years {
+        total += year["cash_on_cash_return"].(float64)
+    }
+    roi.AverageCashOnCashReturn = ff.Round4(total / float64(len(years)))
     return nil
 }
 
 // InitReturnOfInvestment sets the calculated terms in the ReturnOfInvestment
 // struct.
-func InitReturnOfInvestment(roi ReturnOfInvestment) ReturnOfInvestment {
-    return roi
+func InitReturnOfInvestment(roi ReturnOfInvestment) (ReturnOfInvestment, error) {
+    roi.SetAdquisitionCost()
+    err := roi.SetNetCashFlowProjection()
+    if err != nil {
+        return roi, err
+    }
+    err = roi.SetOperatingStatement()
+    if err != nil {
+        return roi, err
+    }
+    err = roi.SetIRR()
+    if err != nil {
+        return roi, err
+    }
+    err = roi.SetEquityMultiple()
+    if err != nil {
+        return roi, err
+    }
+    err = roi.SetAverageCashOnCashReturn()
+    if err != nil {
+        return roi, err
+    }
+    return roi, nil
 }
 
-// Target ROI of the investment
+// Target ROI of the investment. A target of 0 is not required.
 type TargetReturnOfInvestment struct {
     IRR                     float64     `json:"internal_rate_of_return"`
     EquityMultiple          float64     `json:"equity_multiple"`
     AverageCashOnCashReturn float64     `json:"average_cash_on_cash_return"`
 }
 
-//
-func InitTargetReturnOfInvestment (roi ReturnOfInvestment)  (ReturnOfInvestment, error) {
-    roi.SetAdquisitionCost()
-    err := roi.SetNetCashFlowProjection()
+// InitTargetReturnOfInvestment returns the return of the deal bought at the
+// highest purchase price that meets every target, with the loan re-sized on
+// that price.
+func InitTargetReturnOfInvestment (target TargetReturnOfInvestment, roi ReturnOfInvestment)  (ReturnOfInvestment, error) {
+    solution, err := MaximumPurchasePrice(target, roi)
     if err != nil {
-        return roi, err
+        return roi, fmt.Errorf("MaximumPurchasePrice internal error: %w", err)
     }
-    return roi, nil
+    return solution.ReturnOfInvestment, nil
 }
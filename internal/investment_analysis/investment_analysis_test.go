@@ -1,8 +1,13 @@
 package investment_analysis
 import (
+  "errors";
   "testing";
   "fmt";
+  "math";
+  "time";
+  ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
   ls "jacobitosuperstar/LoanSizing/internal/loan_sizer";
+  "jacobitosuperstar/LoanSizing/internal/utils";
 )
 
 
@@ -21,12 +26,12 @@ func TestROI(t *testing.T) {
             DepreciationRecaptureTaxRate: 0.25,
           },
           dealMetrics: DealInformation{
-            PurchasePrice: 6500000,
-            ClosingAndRenovations: 225000,
+            PurchasePrice: 6500000 * ff.Dollar,
+            ClosingAndRenovations: 225000 * ff.Dollar,
             GoingInCapRate: 0.0596,
-            InitRevenue: 687500,
-            InitOperatingExpenses: 300000,
-            InitCapitalReserves: 7500,
+            InitRevenue: 687500 * ff.Dollar,
+            InitOperatingExpenses: 300000 * ff.Dollar,
+            InitCapitalReserves: 7500 * ff.Dollar,
             ProjRevenueGrowth: 0.0350,
             ProjOperatingExpensesGrowth: 0.0250,
             ProjCapitalReservesGrowth: 0.0250,
@@ -38,9 +43,9 @@ func TestROI(t *testing.T) {
             Term: 10,
             IOPeriod: 2,
             Rate: 0.0450,
-            PropertyValue: 0.0,
-            NOI: 0.0,
-            RequestedLoanAmount: 1000000000,
+            PropertyValue: 0,
+            NOI: 0,
+            RequestedLoanAmount: 1000000000 * ff.Dollar,
             LoanOriginationFees: 0.01,
           },
           saleMetrics: SaleTerms{
@@ -54,11 +59,1571 @@ func TestROI(t *testing.T) {
     }
 
     for _, test := range testCases {
-      roi, err := InitTargetReturnOfInvestment(test.input)
+      roi, err := InitTargetReturnOfInvestment(TargetReturnOfInvestment{IRR: 0.10}, test.input)
       if err != nil {
           t.Errorf("got: %v, error: %v", roi, err)
       }
+      if roi.IRR < 0.10 {
+          t.Errorf("got: %g, wanted at least: 0.1", roi.IRR)
+      }
       fmt.Printf("roi: %+v\n", roi)
       // t.Errorf("got: %v", got)
     }
 }
+
+// test_deal returns the metrics of the deal of TestROI and the terms of its
+// loan, not sized yet, for the tests that start from it.
+func test_deal() (TaxAssumptions, DealInformation, ls.LoanSizer, SaleTerms) {
+    taxes := TaxAssumptions{
+      LanBuildingValue: 0.3,
+      FixDepreciationTimeLine: 27,
+      IncomeTaxRate: 0.25,
+      CapitalGainsTaxRate: 0.15,
+      DepreciationRecaptureTaxRate: 0.25,
+    }
+    deal := DealInformation{
+      PurchasePrice: 6500000 * ff.Dollar,
+      ClosingAndRenovations: 225000 * ff.Dollar,
+      InitRevenue: 687500 * ff.Dollar,
+      InitOperatingExpenses: 300000 * ff.Dollar,
+      ProjRevenueGrowth: 0.0350,
+      ProjOperatingExpensesGrowth: 0.0250,
+    }
+    loan := ls.LoanSizer{
+      MaxLTV: 0.70,
+      MinDSCR: 1.25,
+      Amortization: 30,
+      Term: 10,
+      Rate: 0.0650,
+      PropertyValue: 6500000 * ff.Dollar,
+      NOI: 387500 * ff.Dollar,
+      RequestedLoanAmount: 4550000 * ff.Dollar,
+    }
+    sale := SaleTerms{ExitCapRate: 0.0650, CostOfSale: 0.0250, SaleYear: 10}
+    return taxes, deal, loan, sale
+}
+
+func TestSaleCashFlow(t *testing.T) {
+    loan, err := ls.InitLoanSizer(ls.LoanSizer{
+      MaxLTV: 0.70,
+      MinDSCR: 1.25,
+      Amortization: 0,
+      Term: 10,
+      Rate: 0.0650,
+      PropertyValue: 6500000 * ff.Dollar,
+      NOI: 387500 * ff.Dollar,
+      RequestedLoanAmount: 4550000 * ff.Dollar,
+    })
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    roi := NewReturnOfInvestment(
+      TaxAssumptions{LanBuildingValue: 0.3, FixDepreciationTimeLine: 27, IncomeTaxRate: 0.25, CapitalGainsTaxRate: 0.15, DepreciationRecaptureTaxRate: 0.25},
+      DealInformation{
+        PurchasePrice: 6500000 * ff.Dollar,
+        ClosingAndRenovations: 225000 * ff.Dollar,
+        InitRevenue: 687500 * ff.Dollar,
+        InitOperatingExpenses: 300000 * ff.Dollar,
+        ProjRevenueGrowth: 0.0350,
+        ProjOperatingExpensesGrowth: 0.0250,
+      },
+      loan,
+      SaleTerms{ExitCapRate: 0.0650, CostOfSale: 0.0250, SaleYear: 10},
+    )
+    roi.SetAdquisitionCost()
+    err = roi.SetNetCashFlowProjection()
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+
+    // the property is sold in the last year of the term.
+    if len(roi.NetCashFlowProjection) != loan.Term + 1 {
+      t.Fatalf("got: %d rows, wanted: %d", len(roi.NetCashFlowProjection), loan.Term + 1)
+    }
+    last := roi.NetCashFlowProjection[loan.Term]
+    if _, ok := last["sale_price"]; !ok {
+      t.Fatalf("got: %v, wanted the sale in the year %d", last, loan.Term)
+    }
+    // the sale price is the NOI of the year after the term at the exit cap rate.
+    revenue := last["revenue"].(ff.Money)
+    expense := last["expense"].(ff.Money)
+    revenue += revenue.Mul(0.0350)
+    expense += expense.Mul(0.0250)
+    sale_price := roi.saleMetrics.ProjectedSalePrice(revenue - expense)
+    if last["sale_price"].(ff.Money) != sale_price {
+      t.Errorf("got: %v, wanted: %v", last["sale_price"], sale_price)
+    }
+    // the balloon is paid off with the sale.
+    ncf := last["cashflow_after_debt_service"].(ff.Money) + last["income_tax"].(ff.Money)
+    want := ncf + sale_price + last["depreciation_recapture_tax"].(ff.Money) + last["capital_gains_tax"].(ff.Money) - loan.BalloonPayment
+    if last["net_cash_flow"].(ff.Money) != want {
+      t.Errorf("got: %v, wanted: %v", last["net_cash_flow"], want)
+    }
+}
+
+func TestCompareLoanQuotes(t *testing.T) {
+    request := QuoteComparisonRequest{
+      PropertyValue: 6500000 * ff.Dollar,
+      NOI: 387500 * ff.Dollar,
+      Quotes: []LoanQuote{
+        {
+          Lender: "bank",
+          LoanSizer: ls.LoanSizer{
+            MaxLTV: 0.65,
+            MinDSCR: 1.30,
+            Amortization: 25,
+            Term: 10,
+            Rate: 0.0650,
+            RequestedLoanAmount: 3085000 * ff.Dollar,
+            LoanOriginationFees: 0.0075,
+          },
+        },
+        {
+          Lender: "bridge",
+          LoanSizer: ls.LoanSizer{
+            MaxLTV: 0.75,
+            MinDSCR: 1.00,
+            Amortization: 0,
+            Term: 10,
+            Rate: 0.0850,
+            RequestedLoanAmount: 10000000 * ff.Dollar,
+            LoanOriginationFees: 0.015,
+          },
+        },
+        {
+          Lender: "invalid",
+          LoanSizer: ls.LoanSizer{
+            Amortization: -1,
+            Term: 10,
+          },
+        },
+      },
+      DealMetrics: &DealInformation{
+        PurchasePrice: 6500000 * ff.Dollar,
+        ClosingAndRenovations: 225000 * ff.Dollar,
+        InitRevenue: 687500 * ff.Dollar,
+        InitOperatingExpenses: 300000 * ff.Dollar,
+        ProjRevenueGrowth: 0.0350,
+        ProjOperatingExpensesGrowth: 0.0250,
+      },
+      TaxMetrics: TaxAssumptions{
+        LanBuildingValue: 0.3,
+        FixDepreciationTimeLine: 27,
+        IncomeTaxRate: 0.25,
+        CapitalGainsTaxRate: 0.15,
+        DepreciationRecaptureTaxRate: 0.25,
+      },
+      SaleMetrics: SaleTerms{
+        ExitCapRate: 0.0650,
+        CostOfSale: 0.0250,
+        SaleYear: 10,
+      },
+      SortBy: SortByAllInCost,
+    }
+
+    got, err := CompareLoanQuotes(request)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+
+    wantLenders := []string{"bank", "bridge", "invalid"}
+    for i, row := range got.Rows {
+      if row.Lender != wantLenders[i] {
+        t.Errorf("got: %s, wanted: %s", row.Lender, wantLenders[i])
+      }
+    }
+    if got.Rows[1].ProceedsRank != 1 || got.Rows[1].BalloonRank != 2 {
+      t.Errorf("got: %+v, wanted the bridge loan with the most proceeds and the biggest balloon", got.Rows[1])
+    }
+    if got.Rows[2].Error == "" {
+      t.Errorf("got: %+v, wanted a sizing error", got.Rows[2])
+    }
+
+    request.SortBy = "lender"
+    if _, err := CompareLoanQuotes(request); err == nil {
+      t.Errorf("got no error, wanted a validation error for sort_by")
+    }
+
+    // every quote is held until the sale year, a longer term pays the
+    // balloon with the sale and a shorter one can't reach it.
+    longer, shorter := request.Quotes[0], request.Quotes[0]
+    longer.Lender, longer.Term = "longer", 15
+    shorter.Lender, shorter.Term = "shorter", 5
+    request.Quotes = []LoanQuote{request.Quotes[0], longer, shorter}
+    request.SortBy = SortByLeveredIRR
+    got, err = CompareLoanQuotes(request)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if got.Rows[0].LeveredIRR != got.Rows[1].LeveredIRR {
+      t.Errorf("got: %v, wanted: %v", got.Rows[1].LeveredIRR, got.Rows[0].LeveredIRR)
+    }
+    if got.Rows[2].Lender != "shorter" || got.Rows[2].Error == "" {
+      t.Errorf("got: %+v, wanted a term error for the shorter loan", got.Rows[2])
+    }
+
+    request.SaleMetrics.SaleYear = 0
+    var validationError *ff.ValidationError
+    if _, err := CompareLoanQuotes(request); !errors.As(err, &validationError) || validationError.Field != "sale_year" {
+      t.Errorf("got: %v, wanted a validation error for sale_year", err)
+    }
+}
+
+func TestDepreciationSchedule(t *testing.T) {
+    var testCases = []struct {
+        name string
+        taxes TaxAssumptions
+        wantFirst ff.Money
+        wantYears int
+    }{
+      {
+        name: "Straight-line over the whole timeline",
+        taxes: TaxAssumptions{FixDepreciationTimeLine: 27},
+        wantFirst: -4074074 * ff.Cent,
+        wantYears: 27,
+      },
+      {
+        name: "Residential placed in service in January",
+        taxes: TaxAssumptions{DepreciationMethod: DepreciationResidential},
+        wantFirst: -3833333 * ff.Cent,
+        wantYears: 28,
+      },
+      {
+        name: "Nonresidential placed in service in July",
+        taxes: TaxAssumptions{DepreciationMethod: DepreciationNonresidential, PlacedInServiceMonth: 7},
+        wantFirst: -1292735 * ff.Cent,
+        wantYears: 40,
+      },
+      {
+        name: "Cost segregation with bonus depreciation",
+        taxes: TaxAssumptions{
+          DepreciationMethod: DepreciationResidential,
+          CostSegregation: CostSegregation{FiveYear: 0.2},
+          BonusDepreciation: 1,
+        },
+        wantFirst: -25066667 * ff.Cent,
+        wantYears: 28,
+      },
+      {
+        name: "Cost segregation without bonus depreciation",
+        taxes: TaxAssumptions{
+          DepreciationMethod: DepreciationResidential,
+          CostSegregation: CostSegregation{FiveYear: 0.1, SevenYear: 0.1, FifteenYear: 0.1},
+        },
+        wantFirst: -7005233 * ff.Cent,
+        wantYears: 28,
+      },
+    }
+
+    building_value := 1100000 * ff.Dollar
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        got, err := test.taxes.DepreciationSchedule(building_value, 45)
+        if err != nil {
+          t.Fatalf("unexpected error: %v", err)
+        }
+        total, years := ff.Money(0), 0
+        for _, depreciation := range got {
+          total += depreciation
+          if depreciation != 0 {
+            years++
+          }
+        }
+        if got[0] != test.wantFirst || years != test.wantYears || total != -building_value {
+          t.Errorf("got: %v in %d years starting with %v, wanted: %v in %d years starting with %v", total, years, got[0], -building_value, test.wantYears, test.wantFirst)
+        }
+      })
+    }
+
+    if _, err := (TaxAssumptions{DepreciationMethod: "accelerated"}).DepreciationSchedule(building_value, 10); err == nil {
+      t.Errorf("got no error, wanted a validation error for depreciation_method")
+    }
+
+    // the improvements count the months from the month placed in service, the
+    // seventh month after July is January of the next tax year.
+    taxes := TaxAssumptions{DepreciationMethod: DepreciationNonresidential, PlacedInServiceMonth: 7}
+    spend := make([]ff.Money, 12)
+    spend[0] = 390000 * ff.Dollar
+    spend[6] = 390000 * ff.Dollar
+    got, err := taxes.ImprovementDepreciation(spend, 2)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    want := []ff.Money{-458333 * ff.Cent, -1000000 * ff.Cent + -958333 * ff.Cent}
+    for i := range want {
+      if got[i] != want[i] {
+        t.Errorf("got: %v, wanted: %v", got[i], want[i])
+      }
+    }
+}
+
+func TestTaxBasisSale(t *testing.T) {
+    taxes := TaxAssumptions{
+      CapitalGainsTaxRate: 0.15,
+      DepreciationRecaptureTaxRate: 0.25,
+    }
+    tax_basis := NewTaxBasis(6725000 * ff.Dollar)
+    tax_basis.AddImprovement(100000 * ff.Dollar)
+    tax_basis.Depreciate(1000000 * ff.Dollar)
+
+    var testCases = []struct {
+        name string
+        amountRealized ff.Money
+        want SaleGain
+    }{
+      {
+        name: "Gain over the depreciation",
+        amountRealized: 8000000 * ff.Dollar,
+        want: SaleGain{
+          AmountRealized: 8000000 * ff.Dollar,
+          AdjustedBasis: 5825000 * ff.Dollar,
+          TotalGain: 2175000 * ff.Dollar,
+          UnrecapturedGain: 1000000 * ff.Dollar,
+          CapitalGain: 1175000 * ff.Dollar,
+          RecaptureTax: -250000 * ff.Dollar,
+          CapitalGainsTax: -176250 * ff.Dollar,
+        },
+      },
+      {
+        name: "Gain under the depreciation",
+        amountRealized: 6325000 * ff.Dollar,
+        want: SaleGain{
+          AmountRealized: 6325000 * ff.Dollar,
+          AdjustedBasis: 5825000 * ff.Dollar,
+          TotalGain: 500000 * ff.Dollar,
+          UnrecapturedGain: 500000 * ff.Dollar,
+          RecaptureTax: -125000 * ff.Dollar,
+        },
+      },
+      {
+        name: "Loss",
+        amountRealized: 5000000 * ff.Dollar,
+        want: SaleGain{
+          AmountRealized: 5000000 * ff.Dollar,
+          AdjustedBasis: 5825000 * ff.Dollar,
+          TotalGain: -825000 * ff.Dollar,
+        },
+      },
+    }
+
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        got := tax_basis.Sale(test.amountRealized, taxes)
+        if got != test.want {
+          t.Errorf("got: %+v, wanted: %+v", got, test.want)
+        }
+      })
+    }
+
+    // the depreciation of the cost segregated classes is recaptured first, as
+    // ordinary income.
+    taxes.IncomeTaxRate = 0.37
+    cost_segregated := NewTaxBasis(6725000 * ff.Dollar)
+    cost_segregated.AddImprovement(100000 * ff.Dollar)
+    cost_segregated.DepreciatePersonalProperty(200000 * ff.Dollar)
+    cost_segregated.Depreciate(800000 * ff.Dollar)
+    var sectionCases = []struct {
+        name string
+        amountRealized ff.Money
+        want SaleGain
+    }{
+      {
+        name: "Gain over the section 1245 and 1250 depreciation",
+        amountRealized: 8000000 * ff.Dollar,
+        want: SaleGain{
+          AmountRealized: 8000000 * ff.Dollar,
+          AdjustedBasis: 5825000 * ff.Dollar,
+          TotalGain: 2175000 * ff.Dollar,
+          Section1245Gain: 200000 * ff.Dollar,
+          UnrecapturedGain: 800000 * ff.Dollar,
+          CapitalGain: 1175000 * ff.Dollar,
+          RecaptureTax: -274000 * ff.Dollar,
+          CapitalGainsTax: -176250 * ff.Dollar,
+        },
+      },
+      {
+        name: "Gain under the section 1250 depreciation",
+        amountRealized: 6325000 * ff.Dollar,
+        want: SaleGain{
+          AmountRealized: 6325000 * ff.Dollar,
+          AdjustedBasis: 5825000 * ff.Dollar,
+          TotalGain: 500000 * ff.Dollar,
+          Section1245Gain: 200000 * ff.Dollar,
+          UnrecapturedGain: 300000 * ff.Dollar,
+          RecaptureTax: -149000 * ff.Dollar,
+        },
+      },
+      {
+        name: "Gain under the section 1245 depreciation",
+        amountRealized: 5925000 * ff.Dollar,
+        want: SaleGain{
+          AmountRealized: 5925000 * ff.Dollar,
+          AdjustedBasis: 5825000 * ff.Dollar,
+          TotalGain: 100000 * ff.Dollar,
+          Section1245Gain: 100000 * ff.Dollar,
+          RecaptureTax: -37000 * ff.Dollar,
+        },
+      },
+    }
+
+    for _, test := range sectionCases {
+      t.Run(test.name, func(t *testing.T) {
+        got := cost_segregated.Sale(test.amountRealized, taxes)
+        if got != test.want {
+          t.Errorf("got: %+v, wanted: %+v", got, test.want)
+        }
+      })
+    }
+
+    // the amortization of the leasing costs is recaptured as ordinary income,
+    // not as unrecaptured section 1250 gain.
+    amortized := NewTaxBasis(6725000 * ff.Dollar)
+    amortized.AddImprovement(100000 * ff.Dollar)
+    amortized.Depreciate(800000 * ff.Dollar)
+    amortized.Amortize(50000 * ff.Dollar)
+    want := SaleGain{
+      AmountRealized: 7000000 * ff.Dollar,
+      AdjustedBasis: 5975000 * ff.Dollar,
+      TotalGain: 1025000 * ff.Dollar,
+      AmortizationGain: 50000 * ff.Dollar,
+      UnrecapturedGain: 800000 * ff.Dollar,
+      CapitalGain: 175000 * ff.Dollar,
+      RecaptureTax: -218500 * ff.Dollar,
+      CapitalGainsTax: -26250 * ff.Dollar,
+    }
+    if got := amortized.Sale(7000000 * ff.Dollar, taxes); got != want {
+      t.Errorf("got: %+v, wanted: %+v", got, want)
+    }
+}
+
+func TestIncomeTax(t *testing.T) {
+    var testCases = []struct {
+        name string
+        taxMode string
+        taxableIncome ff.Money
+        carryforward ff.Money
+        wantTax ff.Money
+        wantCarryforward ff.Money
+    }{
+      {
+        name: "Passive loss is suspended",
+        taxMode: TaxModePassiveLoss,
+        taxableIncome: -100000 * ff.Dollar,
+        carryforward: 50000 * ff.Dollar,
+        wantTax: 0,
+        wantCarryforward: 150000 * ff.Dollar,
+      },
+      {
+        name: "Carryforward covers the income",
+        taxMode: TaxModePassiveLoss,
+        taxableIncome: 40000 * ff.Dollar,
+        carryforward: 50000 * ff.Dollar,
+        wantTax: 0,
+        wantCarryforward: 10000 * ff.Dollar,
+      },
+      {
+        name: "Carryforward partially used",
+        taxMode: TaxModePassiveLoss,
+        taxableIncome: 80000 * ff.Dollar,
+        carryforward: 50000 * ff.Dollar,
+        wantTax: -7500 * ff.Dollar,
+        wantCarryforward: 0,
+      },
+      {
+        name: "Loss offsets other income",
+        taxMode: TaxModeOffsetIncome,
+        taxableIncome: -100000 * ff.Dollar,
+        carryforward: 0,
+        wantTax: 25000 * ff.Dollar,
+        wantCarryforward: 0,
+      },
+      {
+        name: "Without a tax mode the loss offsets other income",
+        taxMode: "",
+        taxableIncome: -100000 * ff.Dollar,
+        carryforward: 0,
+        wantTax: 25000 * ff.Dollar,
+        wantCarryforward: 0,
+      },
+    }
+
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        taxes := TaxAssumptions{TaxMode: test.taxMode, IncomeTaxRate: 0.25}
+        tax, carryforward := taxes.IncomeTax(test.taxableIncome, test.carryforward)
+        if tax != test.wantTax || carryforward != test.wantCarryforward {
+          t.Errorf("got: %v and %v, wanted: %v and %v", tax, carryforward, test.wantTax, test.wantCarryforward)
+        }
+      })
+    }
+}
+
+func TestPassiveLossProjection(t *testing.T) {
+    _, deal, loan, sale := test_deal()
+    loan, err := ls.InitLoanSizer(loan)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    taxes := TaxAssumptions{
+      TaxMode: TaxModePassiveLoss,
+      LanBuildingValue: 0.2,
+      DepreciationMethod: DepreciationResidential,
+      CostSegregation: CostSegregation{FiveYear: 0.2},
+      BonusDepreciation: 1,
+      IncomeTaxRate: 0.37,
+      CapitalGainsTaxRate: 0.20,
+      DepreciationRecaptureTaxRate: 0.25,
+    }
+
+    roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if roi.NetCashFlowProjection[1]["passive_loss_carryforward"].(ff.Money) <= 0 {
+      t.Errorf("got: %v, wanted a passive loss in the first year", roi.NetCashFlowProjection[1]["passive_loss_carryforward"])
+    }
+    for _, year := range roi.NetCashFlowProjection[1:] {
+      if year["income_tax"].(ff.Money) > 0 {
+        t.Errorf("got: %v, wanted no tax refunds in year %v", year["income_tax"], year["year"])
+      }
+    }
+    last := roi.NetCashFlowProjection[loan.Term]
+    if last["released_passive_loss"] != last["passive_loss_carryforward"] {
+      t.Errorf("got: %v, wanted: %v", last["released_passive_loss"], last["passive_loss_carryforward"])
+    }
+    // the five year class is fully depreciated as section 1245 property.
+    if roi.TaxBasis.Section1245Depreciation != 1040000 * ff.Dollar {
+      t.Errorf("got: %v, wanted: %v", roi.TaxBasis.Section1245Depreciation, 1040000 * ff.Dollar)
+    }
+
+    taxes.TaxMode = "refund"
+    if _, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale)); err == nil {
+      t.Errorf("got no error, wanted a validation error for tax_mode")
+    }
+}
+
+func TestWaterfall(t *testing.T) {
+    var testCases = []struct {
+        name string
+        waterfall Waterfall
+        cashFlows []ff.Money
+        wantLP []ff.Money
+        wantGP []ff.Money
+        wantLPIRR float64
+    }{
+      {
+        name: "Pari passu",
+        waterfall: Waterfall{LPEquityShare: 0.9, PreferredReturn: 0.08},
+        cashFlows: []ff.Money{-1000000 * ff.Dollar, 50000 * ff.Dollar, 1150000 * ff.Dollar},
+        wantLP: []ff.Money{-900000 * ff.Dollar, 45000 * ff.Dollar, 1035000 * ff.Dollar},
+        wantGP: []ff.Money{-100000 * ff.Dollar, 5000 * ff.Dollar, 115000 * ff.Dollar},
+        wantLPIRR: 0.0977,
+      },
+      {
+        name: "Catch-up and promote tiers",
+        waterfall: Waterfall{
+          LPEquityShare: 1,
+          PreferredReturn: 0.08,
+          CatchUp: 1,
+          CatchUpTarget: 0.2,
+          PromoteTiers: []PromoteTier{{IRRHurdle: 0.08, GPShare: 0.2}, {IRRHurdle: 0.2, GPShare: 0.3}},
+        },
+        cashFlows: []ff.Money{-1000000 * ff.Dollar, 1300000 * ff.Dollar},
+        wantLP: []ff.Money{-1000000 * ff.Dollar, 1235000 * ff.Dollar},
+        wantGP: []ff.Money{0, 65000 * ff.Dollar},
+        wantLPIRR: 0.235,
+      },
+      {
+        name: "Compounding preferred return",
+        waterfall: Waterfall{LPEquityShare: 1, PreferredReturn: 0.08, CatchUp: 1, CatchUpTarget: 0.2},
+        cashFlows: []ff.Money{-1000000 * ff.Dollar, 0, 1200000 * ff.Dollar},
+        wantLP: []ff.Money{-1000000 * ff.Dollar, 0, 1166400 * ff.Dollar},
+        wantGP: []ff.Money{0, 0, 33600 * ff.Dollar},
+        wantLPIRR: 0.08,
+      },
+      {
+        name: "Simple preferred return",
+        waterfall: Waterfall{LPEquityShare: 1, PreferredReturn: 0.08, PreferredReturnType: PreferredReturnSimple, CatchUp: 1, CatchUpTarget: 0.2},
+        cashFlows: []ff.Money{-1000000 * ff.Dollar, 0, 1200000 * ff.Dollar},
+        wantLP: []ff.Money{-1000000 * ff.Dollar, 0, 1160000 * ff.Dollar},
+        wantGP: []ff.Money{0, 0, 40000 * ff.Dollar},
+        wantLPIRR: 0.077,
+      },
+      {
+        name: "Capital call after the hurdle is met",
+        waterfall: Waterfall{LPEquityShare: 1, PromoteTiers: []PromoteTier{{IRRHurdle: 0.1, GPShare: 0.2}}},
+        cashFlows: []ff.Money{-1000000 * ff.Dollar, 1200000 * ff.Dollar, -500000 * ff.Dollar, 600000 * ff.Dollar},
+        wantLP: []ff.Money{-1000000 * ff.Dollar, 1180000 * ff.Dollar, -500000 * ff.Dollar, 590000 * ff.Dollar},
+        wantGP: []ff.Money{0, 20000 * ff.Dollar, 0, 10000 * ff.Dollar},
+        wantLPIRR: 0.18,
+      },
+    }
+
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        got, err := test.waterfall.Distribute(test.cashFlows)
+        if err != nil {
+          t.Fatalf("unexpected error: %v", err)
+        }
+        for i := range test.cashFlows {
+          if got.LP.CashFlows[i] != test.wantLP[i] || got.GP.CashFlows[i] != test.wantGP[i] {
+            t.Errorf("got: %v and %v, wanted: %v and %v", got.LP.CashFlows, got.GP.CashFlows, test.wantLP, test.wantGP)
+            break
+          }
+        }
+        if got.LP.IRR != test.wantLPIRR {
+          t.Errorf("got: %g, wanted: %g", got.LP.IRR, test.wantLPIRR)
+        }
+      })
+    }
+
+    if _, err := (Waterfall{LPEquityShare: 1.5}).Distribute([]ff.Money{-100, 110}); err == nil {
+      t.Errorf("got no error, wanted a validation error for lp_equity_share")
+    }
+}
+
+func TestMaximumPurchasePrice(t *testing.T) {
+    taxes, deal, loan, sale := test_deal()
+    loan.MaxLTV = 0.65
+    loan.MinDSCR = 1.30
+    loan.Amortization = 25
+    loan.RequestedLoanAmount = 10000000 * ff.Dollar
+    loan.LoanOriginationFees = 0.0075
+    roi := NewReturnOfInvestment(taxes, deal, loan, sale)
+
+    var testCases = []struct {
+        name string
+        target TargetReturnOfInvestment
+        wantBinding string
+    }{
+      {
+        name: "IRR target",
+        target: TargetReturnOfInvestment{IRR: 0.10},
+        wantBinding: TargetIRR,
+      },
+      {
+        name: "Equity multiple target",
+        target: TargetReturnOfInvestment{IRR: 0.05, EquityMultiple: 2.5},
+        wantBinding: TargetEquityMultiple,
+      },
+      {
+        name: "Cash on cash target after the other targets",
+        target: TargetReturnOfInvestment{IRR: 0.08, EquityMultiple: 2.0, AverageCashOnCashReturn: 0.05},
+        wantBinding: TargetAverageCashOnCashReturn,
+      },
+    }
+
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        got, err := MaximumPurchasePrice(test.target, roi)
+        if err != nil {
+          t.Fatalf("unexpected error: %v", err)
+        }
+        if got.BindingTarget != test.wantBinding || !test.target.meets(got.ReturnOfInvestment) {
+          t.Errorf("got: %v binding %s, wanted the targets met and %s binding", got.PurchasePrice, got.BindingTarget, test.wantBinding)
+        }
+        // a dollar more misses the binding target.
+        higher, err := roi.at_purchase_price(got.PurchasePrice + ff.Dollar)
+        if err != nil || test.target.binding_target(got.ReturnOfInvestment, higher) != test.wantBinding {
+          t.Errorf("got: %+v, wanted %s missed a dollar above %v", higher, test.wantBinding, got.PurchasePrice)
+        }
+      })
+    }
+
+    if _, err := MaximumPurchasePrice(TargetReturnOfInvestment{}, roi); err == nil {
+      t.Errorf("got no error, wanted a validation error without targets")
+    }
+
+    // with an operating statement every candidate price is sized on its NOI.
+    deal.OperatingStatement = OperatingStatement{
+      GrossPotentialRent: LineItem{Amount: 700000 * ff.Dollar},
+      Payroll: LineItem{Amount: 300000 * ff.Dollar},
+    }
+    candidate, err := NewReturnOfInvestment(taxes, deal, loan, sale).at_purchase_price(6000000 * ff.Dollar)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if candidate.loanMetrics.NOI != 400000 * ff.Dollar {
+      t.Errorf("got: %v, wanted: %v", candidate.loanMetrics.NOI, 400000 * ff.Dollar)
+    }
+}
+
+func TestTotalLossIRR(t *testing.T) {
+    taxes, deal, loan, sale := test_deal()
+    deal.InitOperatingExpenses = 900000 * ff.Dollar
+    loan.NOI = deal.InitRevenue - deal.InitOperatingExpenses
+    loan.RequestedLoanAmount = 1000000 * ff.Dollar
+    loan.MinDSCR = 0
+    loan, _ = ls.InitLoanSizer(loan)
+
+    // a deal that doesn't return any cash has an IRR of -1.
+    roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if roi.IRR != -1 {
+      t.Errorf("got: %v, wanted: %v", roi.IRR, -1)
+    }
+}
+
+func TestMonthlyProjection(t *testing.T) {
+    taxes, deal, loan, sale := test_deal()
+    loan.LoanOriginationFees = 0.0075
+
+    var testCases = []struct {
+        name string
+        closingDate utils.Date
+        paymentDay int
+        paymentFrequency int
+    }{
+      {
+        name: "Without dates",
+      },
+      {
+        name: "Dated loan",
+        closingDate: utils.NewDate(2024, time.March, 15),
+      },
+      {
+        name: "Dated loan with monthly payments",
+        closingDate: utils.NewDate(2024, time.March, 15),
+        paymentDay: 1,
+        paymentFrequency: 12,
+      },
+    }
+
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        loan.ClosingDate = test.closingDate
+        loan.PaymentDay = test.paymentDay
+        loan.PaymentFrequency = test.paymentFrequency
+        sized, err := ls.InitLoanSizer(loan)
+        if err != nil {
+          t.Fatalf("unexpected error: %v", err)
+        }
+        yearly, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, sized, sale))
+        if err != nil {
+          t.Fatalf("unexpected error: %v", err)
+        }
+        monthly, err := InitMonthlyReturnOfInvestment(NewReturnOfInvestment(taxes, deal, sized, sale))
+        if err != nil {
+          t.Fatalf("unexpected error: %v", err)
+        }
+
+        if len(monthly.MonthlyCashFlowProjection) != sized.Term * MONTHS_PER_YEAR + 1 {
+          t.Fatalf("got: %d months, wanted: %d", len(monthly.MonthlyCashFlowProjection) - 1, sized.Term * MONTHS_PER_YEAR)
+        }
+        if len(monthly.NetCashFlowProjection) != sized.Term + 1 {
+          t.Fatalf("got: %d years, wanted: %d", len(monthly.NetCashFlowProjection) - 1, sized.Term)
+        }
+        // the roll-up adds up the months of every year.
+        for _, key := range monthly_sum_keys {
+          months, years := ff.Money(0), ff.Money(0)
+          for _, month := range monthly.MonthlyCashFlowProjection[1:] {
+            months += month[key].(ff.Money)
+          }
+          for _, year := range monthly.NetCashFlowProjection[1:] {
+            years += year[key].(ff.Money)
+          }
+          if months != years {
+            t.Errorf("%s got: %v, wanted: %v", key, years, months)
+          }
+        }
+        // the yearly depreciation is the same, only split in months.
+        for i, year := range yearly.NetCashFlowProjection[1:] {
+          got := monthly.NetCashFlowProjection[i+1]["depreciation_expense"]
+          if got != year["depreciation_expense"] {
+            t.Errorf("year %d got: %v, wanted: %v", i+1, got, year["depreciation_expense"])
+          }
+        }
+        // the balloon is the balance left by the monthly payments.
+        balance := sized.MaximumLoanAmount
+        for _, month := range monthly.MonthlyCashFlowProjection[1:] {
+          balance += month["principal_payment"].(ff.Money)
+        }
+        last := monthly.NetCashFlowProjection[sized.Term]
+        if last["balloon_payment"] != balance || balance != sized.BalloonPayment {
+          t.Errorf("got: %v and %v, wanted: %v", last["balloon_payment"], balance, sized.BalloonPayment)
+        }
+        // the months have the payments of the sized loan.
+        for i, year := range yearly.NetCashFlowProjection[1:] {
+          got := monthly.NetCashFlowProjection[i+1]
+          if got["principal_payment"] != year["principal_payment"] || got["interest_payment"] != year["interest_payment"] {
+            t.Errorf("year %d got: %v and %v, wanted: %v and %v", i+1, got["principal_payment"], got["interest_payment"], year["principal_payment"], year["interest_payment"])
+          }
+        }
+        // the monthly cash flows are on the due dates of the schedule.
+        if test.paymentFrequency == 12 {
+          for i, row := range sized.Schedule {
+            if !sized.MonthlyDueDate(i + 1).Equal(row.DueDate.Time) {
+              t.Errorf("month %d got: %v, wanted: %v", i+1, sized.MonthlyDueDate(i + 1), row.DueDate)
+              break
+            }
+          }
+        }
+        // paying and growing monthly moves the returns, but not by much.
+        if math.Abs(monthly.IRR - yearly.IRR) > 0.01 || monthly.IRR == yearly.IRR {
+          t.Errorf("got: %g, wanted close to: %g", monthly.IRR, yearly.IRR)
+        }
+        // the revenue grows during the year instead of at its end.
+        if monthly.EquityMultiple <= yearly.EquityMultiple {
+          t.Errorf("got: %g, wanted more than: %g", monthly.EquityMultiple, yearly.EquityMultiple)
+        }
+      })
+    }
+}
+
+func TestRentRoll(t *testing.T) {
+    lease := Lease{
+      Tenant: "Anchor",
+      SquareFeet: 1000,
+      BaseRent: 20 * ff.Dollar,
+      Escalation: 0.03,
+      LeaseStart: utils.NewDate(2023, time.July, 1),
+      LeaseEnd: utils.NewDate(2026, time.June, 30),
+      RenewalProbability: 0.5,
+      MarketRent: 25 * ff.Dollar,
+      DowntimeMonths: 6,
+      FreeRentMonths: 4,
+      TenantImprovements: 10 * ff.Dollar,
+      LeasingCommission: 0.06,
+    }
+    expired := lease
+    expired.LeaseStart = utils.NewDate(2018, time.January, 1)
+    expired.LeaseEnd = utils.NewDate(2019, time.December, 31)
+    expired.RenewalProbability = 1
+
+    var testCases = []struct {
+        name string
+        rentRoll RentRoll
+        wantRevenue []ff.Money
+        wantLeasingCosts []ff.Money
+        wantErr bool
+    }{
+      {
+        // the lease escalates on July, expires on June 2026 and is leased
+        // again after 3 months of blended downtime and 2 of free rent.
+        name: "Lease rollover",
+        rentRoll: RentRoll{StartDate: utils.NewDate(2025, time.January, 1), Leases: []Lease{lease}},
+        wantRevenue: []ff.Money{2090904 * ff.Cent, 1269235 * ff.Cent, 2518746 * ff.Cent},
+        wantLeasingCosts: []ff.Money{0, -7250 * ff.Dollar, 0},
+      },
+      {
+        // the lease expired before the projection and the space has been
+        // leased again every two years at the market rent, with its leasing
+        // costs paid, so 2025 is the escalated second year of a lease.
+        name: "Lease expired before the start date",
+        rentRoll: RentRoll{StartDate: utils.NewDate(2025, time.January, 1), Leases: []Lease{expired}},
+        wantRevenue: []ff.Money{2574996 * ff.Cent, 2499996 * ff.Cent, 2574996 * ff.Cent},
+        wantLeasingCosts: []ff.Money{0, 0, 0},
+      },
+      {
+        name: "Without start date",
+        rentRoll: RentRoll{Leases: []Lease{lease}},
+        wantErr: true,
+      },
+    }
+
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        revenue, leasing_costs, err := test.rentRoll.Revenue(3)
+        if test.wantErr {
+          if err == nil {
+            t.Errorf("got no error, wanted a validation error")
+          }
+          return
+        }
+        if err != nil {
+          t.Fatalf("unexpected error: %v", err)
+        }
+        if fmt.Sprint(revenue) != fmt.Sprint(test.wantRevenue) {
+          t.Errorf("got: %v, wanted: %v", revenue, test.wantRevenue)
+        }
+        if fmt.Sprint(leasing_costs) != fmt.Sprint(test.wantLeasingCosts) {
+          t.Errorf("got: %v, wanted: %v", leasing_costs, test.wantLeasingCosts)
+        }
+      })
+    }
+
+    // the rent roll replaces the revenue growth in the projection, and the
+    // leasing costs are capitalized in the basis.
+    loan, err := ls.InitLoanSizer(ls.LoanSizer{
+      MaxLTV: 0.60,
+      MinDSCR: 1.25,
+      Amortization: 25,
+      Term: 3,
+      Rate: 0.0650,
+      PropertyValue: 300000 * ff.Dollar,
+      NOI: 15000 * ff.Dollar,
+      RequestedLoanAmount: 150000 * ff.Dollar,
+    })
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    deal := DealInformation{
+      PurchasePrice: 300000 * ff.Dollar,
+      InitRevenue: 1 * ff.Dollar,
+      ProjRevenueGrowth: 0.50,
+      InitOperatingExpenses: 5000 * ff.Dollar,
+      RentRoll: RentRoll{StartDate: utils.NewDate(2025, time.January, 1), Leases: []Lease{lease}},
+    }
+    // the loan is sized on the revenue of the rent roll.
+    noi, err := deal.SizingNOI()
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if noi != 1590904 * ff.Cent {
+      t.Errorf("got: %v, wanted: %v", noi, 1590904 * ff.Cent)
+    }
+    taxes := TaxAssumptions{LanBuildingValue: 0.3, FixDepreciationTimeLine: 39, IncomeTaxRate: 0.25}
+    sale := SaleTerms{ExitCapRate: 0.07, CostOfSale: 0.02, SaleYear: 3}
+    roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if roi.NetCashFlowProjection[2]["revenue"] != 1269235 * ff.Cent || roi.NetCashFlowProjection[2]["leasing_costs"] != -7250 * ff.Dollar {
+      t.Errorf("got: %v and %v, wanted the rent roll revenue and leasing costs", roi.NetCashFlowProjection[2]["revenue"], roi.NetCashFlowProjection[2]["leasing_costs"])
+    }
+    if roi.TaxBasis.CapitalImprovements != 7250 * ff.Dollar {
+      t.Errorf("got: %v, wanted: %v", roi.TaxBasis.CapitalImprovements, 7250 * ff.Dollar)
+    }
+    // the leasing costs of October 2026 are amortized over the 36 months of
+    // the new lease, 3 months in the second year and 12 in the third.
+    building := []ff.Money{-538462 * ff.Cent, -538461 * ff.Cent, -538462 * ff.Cent}
+    amortization := []ff.Money{0, -60417 * ff.Cent, -241666 * ff.Cent}
+    for year := 1; year <= 3; year++ {
+      want := building[year-1] + amortization[year-1]
+      if roi.NetCashFlowProjection[year]["depreciation_expense"] != want {
+        t.Errorf("got: %v, wanted: %v", roi.NetCashFlowProjection[year]["depreciation_expense"], want)
+      }
+    }
+    // the amortization is kept out of the section 1250 depreciation.
+    if roi.TaxBasis.AccumulatedAmortization != 302083 * ff.Cent || roi.TaxBasis.AccumulatedDepreciation != 1615385 * ff.Cent {
+      t.Errorf("got: %+v, wanted the amortization apart from the depreciation", roi.TaxBasis)
+    }
+}
+
+func TestOperatingStatement(t *testing.T) {
+    statement := OperatingStatement{
+      GrossPotentialRent: LineItem{Amount: 1000000 * ff.Dollar, Growth: 0.03},
+      Vacancy: RateItem{Yearly: []float64{0.10, 0.05}},
+      Concessions: RateItem{Rate: 0.01},
+      CreditLoss: RateItem{Rate: 0.005},
+      OtherIncome: LineItem{Amount: 20000 * ff.Dollar, Growth: 0.02},
+      RealEstateTaxes: LineItem{Yearly: []ff.Money{120000 * ff.Dollar, 150000 * ff.Dollar}, Growth: 0.02},
+      Insurance: LineItem{Amount: 30000 * ff.Dollar, Growth: 0.05},
+      Utilities: LineItem{Amount: 40000 * ff.Dollar},
+      RepairsAndMaintenance: LineItem{Amount: 25000 * ff.Dollar},
+      Payroll: LineItem{Amount: 60000 * ff.Dollar},
+      ManagementFee: RateItem{Rate: 0.03},
+    }
+
+    var testCases = []struct {
+        name string
+        statement OperatingStatement
+        wantEGI []ff.Money
+        wantNOI []ff.Money
+        wantErr bool
+    }{
+      {
+        // the taxes follow the yearly amounts and then grow from the last one.
+        name: "Line items",
+        statement: statement,
+        wantEGI: []ff.Money{905000 * ff.Dollar, 983450 * ff.Dollar, 101274950 * ff.Cent},
+        wantNOI: []ff.Money{602850 * ff.Dollar, 64744650 * ff.Cent, 67129201 * ff.Cent},
+      },
+      {
+        name: "Vacancy over 100%",
+        statement: OperatingStatement{Vacancy: RateItem{Rate: 1.5}},
+        wantErr: true,
+      },
+      {
+        // without a rent roll the rates need a gross potential rent.
+        name: "Without gross potential rent",
+        statement: OperatingStatement{ManagementFee: RateItem{Rate: 0.03}},
+        wantErr: true,
+      },
+    }
+
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        got, err := test.statement.Projection(3, nil)
+        if test.wantErr {
+          if err == nil {
+            t.Errorf("got no error, wanted a validation error")
+          }
+          return
+        }
+        if err != nil {
+          t.Fatalf("unexpected error: %v", err)
+        }
+        for i, year := range got {
+          if year.EffectiveGrossIncome != test.wantEGI[i] || year.NOI != test.wantNOI[i] {
+            t.Errorf("year %d got: %v and %v, wanted: %v and %v", year.Year, year.EffectiveGrossIncome, year.NOI, test.wantEGI[i], test.wantNOI[i])
+          }
+        }
+      })
+    }
+
+    // the loan is sized on the NOI of the first year of the statement, and the
+    // projection uses its EGI and total expenses.
+    deal := DealInformation{
+      PurchasePrice: 9000000 * ff.Dollar,
+      InitRevenue: 1 * ff.Dollar,
+      OperatingStatement: statement,
+    }
+    loan, err := deal.SizeLoan(ls.LoanSizer{
+      MaxLTV: 0.65,
+      MinDSCR: 1.25,
+      Amortization: 30,
+      Term: 3,
+      Rate: 0.06,
+      PropertyValue: 9000000 * ff.Dollar,
+      RequestedLoanAmount: 6000000 * ff.Dollar,
+    })
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if loan.NOI != 602850 * ff.Dollar {
+      t.Errorf("got: %v, wanted: %v", loan.NOI, 602850 * ff.Dollar)
+    }
+    taxes := TaxAssumptions{LanBuildingValue: 0.3, FixDepreciationTimeLine: 39, IncomeTaxRate: 0.25}
+    sale := SaleTerms{ExitCapRate: 0.065, CostOfSale: 0.02, SaleYear: 3}
+    roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    first := roi.NetCashFlowProjection[1]
+    if first["revenue"] != 905000 * ff.Dollar || first["expense"] != 302150 * ff.Dollar {
+      t.Errorf("got: %v and %v, wanted the EGI and the total expenses", first["revenue"], first["expense"])
+    }
+    if len(roi.OperatingStatement) != loan.Term {
+      t.Errorf("got: %d years, wanted: %d", len(roi.OperatingStatement), loan.Term)
+    }
+}
+
+func TestCapexPlan(t *testing.T) {
+    plan := CapexPlan{
+      StartDate: utils.NewDate(2025, time.January, 1),
+      Items: []CapexItem{
+        {Category: "roof", Date: utils.NewDate(2025, time.June, 15), Amount: 120000 * ff.Dollar, Funding: FundingHoldback},
+        {Category: "lobby", Date: utils.NewDate(2026, time.March, 1), Amount: 50000 * ff.Dollar, Funding: FundingEquity},
+      },
+      UnitTurns: []UnitTurn{
+        {
+          StartDate: utils.NewDate(2025, time.February, 1),
+          Units: 10,
+          UnitsPerMonth: 2,
+          CostPerUnit: 15000 * ff.Dollar,
+          RentPremium: 150 * ff.Dollar,
+          Funding: FundingReserves,
+        },
+      },
+    }
+
+    // two units are renovated every month from February to June, and they
+    // earn the premium from the next month.
+    got, err := DealInformation{CapexPlan: plan}.capex_projection(3, 1)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    wantSpend := []ff.Money{270000 * ff.Dollar, 50000 * ff.Dollar, 0, 0}
+    wantReleased := []ff.Money{270000 * ff.Dollar, 0, 0, 0}
+    wantPremium := []ff.Money{12000 * ff.Dollar, 18000 * ff.Dollar, 18000 * ff.Dollar, 18000 * ff.Dollar}
+    if fmt.Sprint(got.spend) != fmt.Sprint(wantSpend) {
+      t.Errorf("got: %v, wanted: %v", got.spend, wantSpend)
+    }
+    if fmt.Sprint(got.released) != fmt.Sprint(wantReleased) {
+      t.Errorf("got: %v, wanted: %v", got.released, wantReleased)
+    }
+    if fmt.Sprint(got.rent_premium) != fmt.Sprint(wantPremium) {
+      t.Errorf("got: %v, wanted: %v", got.rent_premium, wantPremium)
+    }
+    wantSummary := CapexSummary{
+      Categories: map[string]ff.Money{"roof": 120000 * ff.Dollar, "lobby": 50000 * ff.Dollar, UNIT_TURNS_CATEGORY: 150000 * ff.Dollar},
+      Equity: 50000 * ff.Dollar,
+      Holdback: 120000 * ff.Dollar,
+      Reserves: 150000 * ff.Dollar,
+    }
+    if fmt.Sprint(got.summary) != fmt.Sprint(wantSummary) {
+      t.Errorf("got: %+v, wanted: %+v", got.summary, wantSummary)
+    }
+
+    // the holdback and the reserve are funded at the closing, and the spend is
+    // capitalized in the basis.
+    taxes, deal, loan, sale := test_deal()
+    loan.Term = 3
+    sale.SaleYear = 3
+    loan, err = ls.InitLoanSizer(loan)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    base, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    deal.CapexPlan = plan
+    roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if roi.AdquisitionCost != base.AdquisitionCost - 270000 * ff.Dollar {
+      t.Errorf("got: %v, wanted: %v", roi.AdquisitionCost, base.AdquisitionCost - 270000 * ff.Dollar)
+    }
+    second := roi.NetCashFlowProjection[2]
+    if second["capital_expenditures"] != -50000 * ff.Dollar || second["rent_premium"] != 18000 * ff.Dollar {
+      t.Errorf("got: %v and %v, wanted the equity funded spend and the premium", second["capital_expenditures"], second["rent_premium"])
+    }
+    if roi.TaxBasis.CapitalImprovements != 320000 * ff.Dollar {
+      t.Errorf("got: %v, wanted: %v", roi.TaxBasis.CapitalImprovements, 320000 * ff.Dollar)
+    }
+    if roi.TaxBasis.AccumulatedDepreciation <= base.TaxBasis.AccumulatedDepreciation {
+      t.Errorf("got: %v, wanted the improvements depreciated", roi.TaxBasis.AccumulatedDepreciation)
+    }
+
+    // the monthly projection rolls up to the same spend.
+    monthly, err := InitMonthlyReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if monthly.NetCashFlowProjection[1]["capex_funding"] != 270000 * ff.Dollar {
+      t.Errorf("got: %v, wanted: %v", monthly.NetCashFlowProjection[1]["capex_funding"], 270000 * ff.Dollar)
+    }
+
+    deal.CapexPlan.Items[0].Amount = 5000000 * ff.Dollar
+    if _, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale)); err == nil {
+      t.Errorf("got no error, wanted a validation error for the holdback")
+    }
+
+    // the turns stop at the sale, only the units renovated in the last month
+    // of the term earn the premium of the year after it.
+    late := CapexPlan{
+      StartDate: utils.NewDate(2025, time.January, 1),
+      UnitTurns: []UnitTurn{
+        {
+          StartDate: utils.NewDate(2027, time.December, 1),
+          Units: 10,
+          UnitsPerMonth: 2,
+          CostPerUnit: 15000 * ff.Dollar,
+          RentPremium: 150 * ff.Dollar,
+        },
+      },
+    }
+    got, err = DealInformation{CapexPlan: late}.capex_projection(3, 1)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if got.spend[2] != 30000 * ff.Dollar || got.rent_premium[3] != 3600 * ff.Dollar {
+      t.Errorf("got: %v and %v, wanted: %v and %v", got.spend[2], got.rent_premium[3], 30000 * ff.Dollar, 3600 * ff.Dollar)
+    }
+
+    early := CapexPlan{
+      StartDate: utils.NewDate(2025, time.January, 1),
+      Items: []CapexItem{
+        {Category: "roof", Date: utils.NewDate(2024, time.June, 15), Amount: 120000 * ff.Dollar},
+      },
+    }
+    if err := early.Validate(); err == nil {
+      t.Errorf("got no error, wanted a validation error for the date")
+    }
+}
+
+func TestRunScenarios(t *testing.T) {
+    taxes, deal, loan, sale := test_deal()
+    set := ScenarioSet{
+      TaxMetrics: taxes,
+      DealMetrics: deal,
+      LoanMetrics: loan,
+      SaleMetrics: sale,
+      Scenarios: []Scenario{
+        {
+          Name: "downside",
+          DealMetrics: []byte(`{"projected_revenue_growth": 0.01}`),
+          SaleMetrics: []byte(`{"exit_cap_rate": 0.075}`),
+        },
+        {
+          Name: "lower rate",
+          LoanMetrics: []byte(`{"rate": 0.055}`),
+        },
+        {
+          Name: "invalid",
+          LoanMetrics: []byte(`{"rate": "high"}`),
+        },
+        {
+          Name: "operating statement",
+          DealMetrics: []byte(`{"operating_statement": {"gross_potential_rent": {"amount": 700000}, "vacancy": {"rate": 0.05}, "payroll": {"amount": 300000}}}`),
+        },
+      },
+    }
+
+    got, err := RunScenarios(set)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    loan, _ = ls.InitLoanSizer(loan)
+    base, _ := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if got.Base.Metrics.IRR != base.IRR || got.Base.Metrics.LoanAmount != loan.MaximumLoanAmount {
+      t.Errorf("got: %+v, wanted the metrics of the base deal", got.Base.Metrics)
+    }
+
+    downside := got.Scenarios[0]
+    if downside.Error != "" || downside.Delta.IRR >= 0 || downside.Delta.LoanAmount != 0 {
+      t.Errorf("got: %+v, wanted a lower IRR with the same loan", downside.Delta)
+    }
+    if downside.ReturnOfInvestment.dealMetrics.ProjOperatingExpensesGrowth != set.DealMetrics.ProjOperatingExpensesGrowth {
+      t.Errorf("got: %g, wanted the base fields kept", downside.ReturnOfInvestment.dealMetrics.ProjOperatingExpensesGrowth)
+    }
+    lower_rate := got.Scenarios[1]
+    // the loan is sized by the DSCR, so a lower rate sizes a bigger loan.
+    if lower_rate.Error != "" || lower_rate.Delta.LoanAmount <= 0 || lower_rate.Delta.IRR <= 0 {
+      t.Errorf("got: %+v, wanted a bigger loan and a higher IRR", lower_rate.Delta)
+    }
+    if got.Scenarios[2].Error == "" {
+      t.Errorf("got no error, wanted the invalid overrides kept with their error")
+    }
+    // the loan is sized on the NOI of the operating statement.
+    if statement := got.Scenarios[3]; statement.Error != "" || statement.ReturnOfInvestment.loanMetrics.NOI != 365000 * ff.Dollar {
+      t.Errorf("got: %v, wanted: %v", statement.ReturnOfInvestment.loanMetrics.NOI, 365000 * ff.Dollar)
+    }
+
+    set.Scenarios = append(set.Scenarios, Scenario{Name: "downside"})
+    if _, err := RunScenarios(set); err == nil {
+      t.Errorf("got no error, wanted a validation error for the repeated name")
+    }
+}
+
+func TestSensitivity(t *testing.T) {
+    taxes, deal, loan, sale := test_deal()
+    loan, err := ls.InitLoanSizer(loan)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+
+    table, err := roi.Sensitivity(
+      SensitivityInput{Input: "sale_terms.exit_cap_rate", Values: []float64{0.06, 0.065, 0.07}},
+      SensitivityInput{Input: "deal_information.projected_revenue_growth", Values: []float64{0.02, 0.035}},
+    )
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if table.Errors != nil {
+      t.Fatalf("got: %v, wanted no errors", table.Errors)
+    }
+    // the base inputs give the base returns.
+    if table.IRR[1][1] != roi.IRR || table.EquityMultiple[1][1] != roi.EquityMultiple {
+      t.Errorf("got: %g and %g, wanted: %g and %g", table.IRR[1][1], table.EquityMultiple[1][1], roi.IRR, roi.EquityMultiple)
+    }
+    for i := range table.IRR {
+      if i > 0 && table.IRR[i][0] >= table.IRR[i-1][0] {
+        t.Errorf("got: %v, wanted a lower IRR with a higher exit cap rate", table.IRR)
+      }
+      if table.IRR[i][1] <= table.IRR[i][0] {
+        t.Errorf("got: %v, wanted a higher IRR with a higher revenue growth", table.IRR)
+      }
+    }
+
+    // the loan follows the purchase price.
+    table, err = roi.Sensitivity(
+      SensitivityInput{Input: "deal_information.purchase_price", Values: []float64{6000000}},
+      SensitivityInput{Input: "loan_sizer.rate", Values: []float64{0.065, 0.07}},
+    )
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    want, _ := roi.at_purchase_price(6000000 * ff.Dollar)
+    if table.IRR[0][0] != want.IRR {
+      t.Errorf("got: %g, wanted: %g", table.IRR[0][0], want.IRR)
+    }
+
+    var testCases = []struct {
+        name string
+        row SensitivityInput
+        column SensitivityInput
+    }{
+      {
+        name: "Unknown field",
+        row: SensitivityInput{Input: "sale_terms.exit_year", Values: []float64{1}},
+        column: SensitivityInput{Input: "loan_sizer.rate", Values: []float64{0.05}},
+      },
+      {
+        name: "Same input",
+        row: SensitivityInput{Input: "loan_sizer.rate", Values: []float64{0.05}},
+        column: SensitivityInput{Input: "loan_sizer.rate", Values: []float64{0.06}},
+      },
+      {
+        name: "Text field",
+        row: SensitivityInput{Input: "tax_assumptions.tax_mode", Values: []float64{1}},
+        column: SensitivityInput{Input: "loan_sizer.rate", Values: []float64{0.05}},
+      },
+      {
+        name: "Object field",
+        row: SensitivityInput{Input: "deal_information.rent_roll", Values: []float64{1}},
+        column: SensitivityInput{Input: "loan_sizer.rate", Values: []float64{0.05}},
+      },
+    }
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        if _, err := roi.Sensitivity(test.row, test.column); err == nil {
+          t.Errorf("got no error, wanted a validation error")
+        }
+      })
+    }
+}
+
+func TestSimulate(t *testing.T) {
+    taxes, deal, loan, sale := test_deal()
+    loan, err := ls.InitLoanSizer(loan)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+
+    simulation := Simulation{
+      Distributions: []Distribution{
+        {Variable: SimulateRevenueGrowth, Type: DistributionNormal, Mean: 0.035, StdDev: 0.02},
+        {Variable: SimulateExpenseGrowth, Type: DistributionTriangular, Min: 0.015, Mode: 0.025, Max: 0.045},
+        {Variable: SimulateExitCapRate, Type: DistributionUniform, Min: 0.055, Max: 0.080},
+      },
+      Correlations: [][]float64{
+        {1, 0.5, -0.3},
+        {0.5, 1, 0},
+        {-0.3, 0, 1},
+      },
+      Iterations: 200,
+      Seed: 42,
+    }
+    result, err := roi.Simulate(simulation)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if result.FailedIterations != 0 {
+      t.Errorf("got: %d, wanted: 0", result.FailedIterations)
+    }
+    if result.IRR.P5 > result.IRR.P50 || result.IRR.P50 > result.IRR.P95 {
+      t.Errorf("got: %+v, wanted increasing percentiles", result.IRR)
+    }
+    // the base deal is in the middle of the distribution.
+    if roi.IRR < result.IRR.P5 || roi.IRR > result.IRR.P95 {
+      t.Errorf("got: %+v, wanted the base IRR %g inside", result.IRR, roi.IRR)
+    }
+    if result.ProbabilityOfLoss < 0 || result.ProbabilityOfLoss > 1 || result.ProbabilityOfBreach < 0 || result.ProbabilityOfBreach > 1 {
+      t.Errorf("got: %g and %g, wanted probabilities", result.ProbabilityOfLoss, result.ProbabilityOfBreach)
+    }
+    // the same seed gives the same results.
+    again, err := roi.Simulate(simulation)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if again != result {
+      t.Errorf("got: %+v, wanted: %+v", again, result)
+    }
+    simulation.Seed = 7
+    other, _ := roi.Simulate(simulation)
+    if other == result {
+      t.Errorf("got the same results with another seed")
+    }
+
+    // a covenant over every DSCR of the deal is always breached.
+    simulation.DSCRCovenant = 100
+    breached, _ := roi.Simulate(simulation)
+    if breached.ProbabilityOfBreach != 1 {
+      t.Errorf("got: %g, wanted: 1", breached.ProbabilityOfBreach)
+    }
+
+    var testCases = []struct {
+        name string
+        simulation Simulation
+    }{
+      {
+        name: "No iterations",
+        simulation: Simulation{Distributions: simulation.Distributions[:1]},
+      },
+      {
+        name: "Unknown variable",
+        simulation: Simulation{Iterations: 10, Distributions: []Distribution{{Variable: "purchase_price", Type: DistributionNormal}}},
+      },
+      {
+        name: "Invalid triangular",
+        simulation: Simulation{Iterations: 10, Distributions: []Distribution{{Variable: SimulateExitCapRate, Type: DistributionTriangular, Min: 0.06, Mode: 0.05, Max: 0.07}}},
+      },
+      {
+        name: "Repeated variable",
+        simulation: Simulation{Iterations: 10, Distributions: []Distribution{simulation.Distributions[0], simulation.Distributions[0]}},
+      },
+      {
+        name: "Not positive definite",
+        simulation: Simulation{
+          Iterations: 10,
+          Distributions: simulation.Distributions[:2],
+          Correlations: [][]float64{{1, 1}, {1, 1}},
+        },
+      },
+      {
+        name: "Vacancy without an operating statement",
+        simulation: Simulation{Iterations: 10, Distributions: []Distribution{{Variable: SimulateVacancy, Type: DistributionUniform, Min: 0.05, Max: 0.10}}},
+      },
+    }
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        if _, err := roi.Simulate(test.simulation); err == nil {
+          t.Errorf("got no error, wanted a validation error")
+        }
+      })
+    }
+
+    // the revenue of a rent roll doesn't follow the revenue growth.
+    leased := roi
+    leased.dealMetrics.RentRoll = RentRoll{
+      StartDate: utils.NewDate(2025, time.January, 1),
+      Leases: []Lease{{SquareFeet: 1000, BaseRent: 20 * ff.Dollar, LeaseStart: utils.NewDate(2024, time.January, 1), LeaseEnd: utils.NewDate(2034, time.December, 31)}},
+    }
+    if _, err := leased.Simulate(Simulation{Iterations: 10, Distributions: simulation.Distributions[:1]}); err == nil {
+      t.Errorf("got no error, wanted a validation error for the revenue growth")
+    }
+
+    // the exit cap rates under 0 are truncated, so every iteration is
+    // projected.
+    truncated, err := roi.Simulate(Simulation{Iterations: 10, Distributions: []Distribution{{Variable: SimulateExitCapRate, Type: DistributionNormal, Mean: -0.01}}})
+    if err != nil || truncated.FailedIterations != 0 {
+      t.Errorf("got: %+v and %v, wanted every iteration projected", truncated, err)
+    }
+
+    // the years with a negative NOI breach the covenant.
+    losing := roi
+    losing.dealMetrics.InitOperatingExpenses = 800000 * ff.Dollar
+    breached, err = losing.Simulate(Simulation{Iterations: 10, Distributions: simulation.Distributions[1:2]})
+    if err != nil || breached.ProbabilityOfBreach != 1 {
+      t.Errorf("got: %+v and %v, wanted a breach in every iteration", breached, err)
+    }
+}
+
+func TestBreakEven(t *testing.T) {
+    taxes, deal, loan, sale := test_deal()
+    loan, err := ls.InitLoanSizer(loan)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+
+    result, err := roi.BreakEven(roi.IRR)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    first_year := roi.NetCashFlowProjection[1]
+    debt_service := - first_year["principal_payment"].(ff.Money) - first_year["interest_payment"].(ff.Money)
+    occupancy := ff.Round4((300000 * ff.Dollar + debt_service).Ratio(687500 * ff.Dollar))
+    if result.Occupancy[0] != occupancy {
+      t.Errorf("got: %g, wanted: %g", result.Occupancy[0], occupancy)
+    }
+    // the NOI grows faster than the expenses.
+    if result.Occupancy[9] >= result.Occupancy[0] {
+      t.Errorf("got: %v, wanted a lower occupancy in the last year", result.Occupancy)
+    }
+
+    // the IRR of the deal is met at its own exit cap rate.
+    if math.Abs(result.TargetExitCapRate - sale.ExitCapRate) > 0.0005 {
+      t.Errorf("got: %g, wanted: %g", result.TargetExitCapRate, sale.ExitCapRate)
+    }
+    irr, err := roi.irr_at_exit_cap_rate(result.ExitCapRate)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if result.ExitCapRate <= sale.ExitCapRate || math.Abs(irr) > 0.001 {
+      t.Errorf("got: %g with an IRR of %g, wanted an IRR of 0", result.ExitCapRate, irr)
+    }
+
+    // the loan is sized on the minimum DSCR at its rate.
+    if math.Abs(result.MaximumInterestRate - loan.Rate) > 0.0005 {
+      t.Errorf("got: %g, wanted: %g", result.MaximumInterestRate, loan.Rate)
+    }
+
+    decline := ff.Round4(first_year["cashflow_after_debt_service"].(ff.Money).Ratio(first_year["revenue"].(ff.Money)))
+    if result.MaximumRevenueDecline != decline {
+      t.Errorf("got: %g, wanted: %g", result.MaximumRevenueDecline, decline)
+    }
+
+    var testCases = []struct {
+        name string
+        roi ReturnOfInvestment
+    }{
+      {
+        name: "Projection not set",
+        roi: NewReturnOfInvestment(taxes, deal, loan, sale),
+      },
+    }
+    for _, test := range testCases {
+      t.Run(test.name, func(t *testing.T) {
+        if _, err := test.roi.BreakEven(0); err == nil {
+          t.Errorf("got no error, wanted a validation error")
+        }
+      })
+    }
+
+    // without a minimum DSCR the other thresholds are still returned.
+    no_dscr := roi
+    no_dscr.loanMetrics.MinDSCR = 0
+    partial, err := no_dscr.BreakEven(0)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if partial.Errors["maximum_interest_rate"] == "" || len(partial.Errors) != 1 || partial.ExitCapRate != result.ExitCapRate {
+      t.Errorf("got: %+v, wanted only the maximum interest rate missing", partial)
+    }
+
+    // the target IRR of a deal with a small loan is met up to an exit cap
+    // rate between 0.70 and 1.
+    small := loan
+    small.RequestedLoanAmount = 1000000 * ff.Dollar
+    small, err = ls.InitLoanSizer(small)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    small_roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, small, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    rate, err := small_roi.ExitCapRateForIRR(-0.09)
+    if err != nil || rate <= 0.70 || rate >= 1 {
+      t.Errorf("got: %g and %v, wanted a rate between 0.70 and 1", rate, err)
+    }
+
+    // with an operating statement the occupancy and the revenue decline keep
+    // the other income and lower the management fee with the revenue, so the
+    // rent at the break-even occupancy is the rent after the decline.
+    deal.OperatingStatement = OperatingStatement{
+      GrossPotentialRent: LineItem{Amount: 700000 * ff.Dollar, Growth: 0.03},
+      Vacancy: RateItem{Rate: 0.05},
+      OtherIncome: LineItem{Amount: 40000 * ff.Dollar},
+      Payroll: LineItem{Amount: 250000 * ff.Dollar, Growth: 0.02},
+      ManagementFee: RateItem{Rate: 0.04},
+    }
+    statement_roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    statement_result, err := statement_roi.BreakEven(0)
+    if err != nil {
+      t.Fatalf("unexpected error: %v", err)
+    }
+    if statement_result.Errors["break_even_occupancy"] != "" || statement_result.Errors["maximum_revenue_decline"] != "" {
+      t.Fatalf("unexpected errors: %v", statement_result.Errors)
+    }
+    // the rent grows faster than the payroll, so the first year is the worst.
+    first_statement := statement_roi.OperatingStatement[0]
+    potential_rent := first_statement.GrossPotentialRent.Float64()
+    rent := potential_rent - first_statement.Vacancy.Float64()
+    occupancy_rent := statement_result.Occupancy[0] * potential_rent
+    decline_rent := rent * (1 - statement_result.MaximumRevenueDecline)
+    if math.Abs(occupancy_rent - decline_rent) > 100 {
+      t.Errorf("got: %g and %g, wanted the same rent", occupancy_rent, decline_rent)
+    }
+}
@@ -0,0 +1,163 @@
+// Monthly projection of the deal. The yearly inputs of the deal are split in
+// months, the growth compounds every month with the monthly rate equivalent to
+// the yearly growth, and the debt service is paid in the months of the
+// payments of the loan. The months are rolled up in years, so the yearly view
+// of the projection is still available, and the IRR is calculated from the
+// monthly cash flows.
+
+package investment_analysis
+
+import (
+    "fmt";
+    "time";
+    "math";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+)
+
+// MONTHS_PER_YEAR of the monthly projection.
+const MONTHS_PER_YEAR = 12
+
+// Keys of the monthly projection added up in the yearly roll-up. The other
+// amounts of the year are the ones at the end of the year.
+var monthly_sum_keys = []string{
+    "revenue",
+    "rent_premium",
+    "expense",
+    "noi",
+    "reserve",
+    "leasing_costs",
+    "capital_expenditures",
+    "capex_funding",
+    "principal_payment",
+    "interest_payment",
+    "cashflow_after_debt_service",
+    "depreciation_expense",
+    "taxable_income",
+    "income_tax",
+    "net_cash_flow",
+}
+
+// Keys of the sale in the last month, carried to the last year of the
+// roll-up.
+var sale_keys = []string{
+    "sale_price",
+    "balloon_payment",
+    "depreciation_recapture_tax",
+    "capital_gains_tax",
+    "total_gain",
+    "unrecaptured_section_1250_gain",
+    "capital_gain",
+    "released_passive_loss",
+    "released_passive_loss_tax",
+}
+
+// roll_up returns the yearly view of the monthly projection, starting with the
+// adquisition.
+func (roi ReturnOfInvestment) roll_up (monthly_projection []map[string]interface{}) []map[string]interface{} {
+    yearly_projection := []map[string]interface{}{
+        {"net_cash_flow": monthly_projection[0]["net_cash_flow"]},
+    }
+    months := monthly_projection[1:]
+    for start := 0; start < len(months); start += MONTHS_PER_YEAR {
+        year := map[string]interface{}{
+            "year": start / MONTHS_PER_YEAR + 1,
+        }
+        for _, key := range monthly_sum_keys {
+            total := ff.Money(0)
+            for _, month := range months[start:start + MONTHS_PER_YEAR] {
+                total += month[key].(ff.Money)
+            }
+            year[key] = total
+        }
+        year_end := months[start + MONTHS_PER_YEAR - 1]
+        year["adjusted_basis"] = year_end["adjusted_basis"]
+        year["passive_loss_carryforward"] = year_end["passive_loss_carryforward"]
+        // the sale is in the last month and in the last year.
+        for _, key := range sale_keys {
+            if amount, ok := year_end[key]; ok {
+                year[key] = amount
+            }
+        }
+        year["implied_income_tax"] = ff.Round4(math.Abs(year["income_tax"].(ff.Money).Ratio(year["cashflow_after_debt_service"].(ff.Money))))
+        year["cash_on_cash_return"] = roi.CashOnCashReturn(year["net_cash_flow"].(ff.Money))
+        yearly_projection = append(yearly_projection, year)
+    }
+    return yearly_projection
+}
+
+// SetMonthlyCashFlowProjection sets the MonthlyCashFlowProjection of the Deal
+// and its yearly roll-up in the NetCashFlowProjection. The property is sold at
+// the end of the term with the NOI of the next twelve months, and the balloon
+// is the balance left by the payments of the loan.
+func (roi *ReturnOfInvestment) SetMonthlyCashFlowProjection () error {
+    monthly_projection, err := roi.cash_flow_projection(MONTHS_PER_YEAR)
+    if err != nil {
+        return err
+    }
+    monthly_projection[0]["month"] = 0
+    // Setting the value
+    roi.MonthlyCashFlowProjection = monthly_projection
+    roi.NetCashFlowProjection = roi.roll_up(monthly_projection)
+    return nil
+}
+
+// SetMonthlyIRR sets the levered internal rate of return of the Deal from the
+// monthly cash flows. With a dated loan the first cash flow is on the closing
+// date and the others on the payment day of every month, the due dates of the
+// schedule, otherwise the monthly rate is compounded to a yearly rate.
+func (roi *ReturnOfInvestment) SetMonthlyIRR () error {
+    net_cash_flows := make([]float64, len(roi.MonthlyCashFlowProjection))
+    for i, month := range roi.MonthlyCashFlowProjection {
+        net_cash_flows[i] = month["net_cash_flow"].(ff.Money).Float64()
+    }
+
+    loan := roi.loanMetrics
+    if loan.IsDated() {
+        dates := make([]time.Time, len(net_cash_flows))
+        dates[0] = loan.ClosingDate.Time
+        for i := 1; i < len(dates); i++ {
+            dates[i] = loan.MonthlyDueDate(i).Time
+        }
+        irr, err := ff.ExtendedInternalRateOfReturn(net_cash_flows, dates)
+        if err != nil {
+            return fmt.Errorf("ExtendedInternalRateOfReturn internal error: %v", err)
+        }
+        roi.IRR = ff.Round4(irr)
+        return nil
+    }
+
+    irr, err := ff.InternalRateOfReturn(net_cash_flows)
+    if err != nil {
+        return fmt.Errorf("InternalRateOfReturn internal error: %v", err)
+    }
+    roi.IRR = ff.Round4(ff.PeriodicRate(irr, MONTHS_PER_YEAR).Effective())
+    return nil
+}
+
+// InitMonthlyReturnOfInvestment sets the calculated terms in the
+// ReturnOfInvestment struct with the monthly projection. The equity multiple
+// and the average cash on cash return come from the yearly roll-up.
+func InitMonthlyReturnOfInvestment (roi ReturnOfInvestment) (ReturnOfInvestment, error) {
+    roi.SetAdquisitionCost()
+    err := roi.SetMonthlyCashFlowProjection()
+    if err != nil {
+        return roi, err
+    }
+    err = roi.SetOperatingStatement()
+    if err != nil {
+        return roi, err
+    }
+    err = roi.SetMonthlyIRR()
+    if err != nil {
+        return roi, err
+    }
+    err = roi.SetEquityMultiple()
+    if err != nil {
+        return roi, err
+    }
+    err = roi.SetAverageCashOnCashReturn()
+    if err != nil {
+        return roi, err
+    }
+    return roi, nil
+}
@@ -0,0 +1,372 @@
+// Line-item operating statement of the property. The revenue is the gross
+// potential rent (GPR) less the vacancy, the concessions and the credit loss,
+// plus the other income, that is the effective gross income (EGI). The
+// expenses are broken out by line, and the management fee is a fraction of the
+// EGI. Every line grows with its own rate, or follows explicit yearly amounts.
+
+package investment_analysis
+
+import (
+    "fmt";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    ls "jacobitosuperstar/LoanSizing/internal/loan_sizer";
+)
+
+// LineItem is a yearly amount of the operating statement. The amount of the
+// first year grows every year with the growth rate. When yearly amounts are
+// given they are used instead, and the last one grows with the growth rate
+// after them.
+type LineItem struct {
+    Amount      ff.Money    `json:"amount"`
+    Growth      float64     `json:"growth"`
+    Yearly      []ff.Money  `json:"yearly"`
+}
+
+// RateItem is a fraction of the gross potential rent, or of the EGI, that can
+// change every year. The last yearly rate is kept after them.
+type RateItem struct {
+    Rate        float64     `json:"rate"`
+    Yearly      []float64   `json:"yearly"`
+}
+
+// OperatingStatement has the revenue and expense lines of the property. The
+// vacancy, the concessions and the credit loss are fractions of the gross
+// potential rent, and the management fee is a fraction of the EGI.
+type OperatingStatement struct {
+    GrossPotentialRent      LineItem    `json:"gross_potential_rent"`
+    Vacancy                 RateItem    `json:"vacancy"`
+    Concessions             RateItem    `json:"concessions"`
+    CreditLoss              RateItem    `json:"credit_loss"`
+    OtherIncome             LineItem    `json:"other_income"`
+    RealEstateTaxes         LineItem    `json:"real_estate_taxes"`
+    Insurance               LineItem    `json:"insurance"`
+    Utilities               LineItem    `json:"utilities"`
+    RepairsAndMaintenance   LineItem    `json:"repairs_and_maintenance"`
+    Payroll                 LineItem    `json:"payroll"`
+    ManagementFee           RateItem    `json:"management_fee"`
+}
+
+// OperatingYear is the operating statement of a year of the projection. The
+// deductions from the gross potential rent and the expenses are positive.
+type OperatingYear struct {
+    Year                    int         `json:"year"`
+    GrossPotentialRent      ff.Money    `json:"gross_potential_rent"`
+    Vacancy                 ff.Money    `json:"vacancy"`
+    Concessions             ff.Money    `json:"concessions"`
+    CreditLoss              ff.Money    `json:"credit_loss"`
+    OtherIncome             ff.Money    `json:"other_income"`
+    EffectiveGrossIncome    ff.Money    `json:"effective_gross_income"`
+    RealEstateTaxes         ff.Money    `json:"real_estate_taxes"`
+    Insurance               ff.Money    `json:"insurance"`
+    Utilities               ff.Money    `json:"utilities"`
+    RepairsAndMaintenance   ff.Money    `json:"repairs_and_maintenance"`
+    Payroll                 ff.Money    `json:"payroll"`
+    ManagementFee           ff.Money    `json:"management_fee"`
+    TotalExpenses           ff.Money    `json:"total_expenses"`
+    NOI                     ff.Money    `json:"noi"`
+}
+
+// is_supplied returns if the line has an amount.
+func (li LineItem) is_supplied () bool {
+    return li.Amount != 0 || len(li.Yearly) > 0
+}
+
+// validate checks the amounts and the growth of the line.
+func (li LineItem) validate (field string) error {
+    if li.Amount < 0 {
+        return &ff.ValidationError{Field: field, Value: li.Amount, Message: "The amount must be 0 or greater"}
+    }
+    for _, amount := range li.Yearly {
+        if amount < 0 {
+            return &ff.ValidationError{Field: field, Value: li.Yearly, Message: "The yearly amounts must be 0 or greater"}
+        }
+    }
+    if li.Growth <= -1 {
+        return &ff.ValidationError{Field: field, Value: li.Growth, Message: "The growth must be greater than -1"}
+    }
+    return nil
+}
+
+// projection returns the amount of the line for every year.
+func (li LineItem) projection (years int) []ff.Money {
+    amounts := make([]ff.Money, years)
+    current := li.Amount
+    for i := range amounts {
+        if i < len(li.Yearly) {
+            current = li.Yearly[i]
+        }
+        amounts[i] = current
+        current += current.Mul(li.Growth)
+    }
+    return amounts
+}
+
+// is_supplied returns if the rate is used.
+func (ri RateItem) is_supplied () bool {
+    return ri.Rate != 0 || len(ri.Yearly) > 0
+}
+
+// validate checks that every rate is a fraction.
+func (ri RateItem) validate (field string) error {
+    for _, rate := range append([]float64{ri.Rate}, ri.Yearly...) {
+        if rate < 0 || rate > 1 {
+            return &ff.ValidationError{Field: field, Value: rate, Message: "The value must be between 0 and 1"}
+        }
+    }
+    return nil
+}
+
+// at returns the rate of the year, starting at 0.
+func (ri RateItem) at (year int) float64 {
+    if len(ri.Yearly) == 0 {
+        return ri.Rate
+    }
+    if year >= len(ri.Yearly) {
+        return ri.Yearly[len(ri.Yearly) - 1]
+    }
+    return ri.Yearly[year]
+}
+
+// amount_line is a line with amounts and its field name.
+type amount_line struct {
+    field   string
+    line    LineItem
+}
+
+// rate_line is a line with rates and its field name.
+type rate_line struct {
+    field   string
+    line    RateItem
+}
+
+// amount_lines returns the lines with amounts in the order of the statement.
+func (os OperatingStatement) amount_lines () []amount_line {
+    return []amount_line{
+        {"gross_potential_rent", os.GrossPotentialRent},
+        {"other_income", os.OtherIncome},
+        {"real_estate_taxes", os.RealEstateTaxes},
+        {"insurance", os.Insurance},
+        {"utilities", os.Utilities},
+        {"repairs_and_maintenance", os.RepairsAndMaintenance},
+        {"payroll", os.Payroll},
+    }
+}
+
+// rate_lines returns the lines with rates in the order of the statement.
+func (os OperatingStatement) rate_lines () []rate_line {
+    return []rate_line{
+        {"vacancy", os.Vacancy},
+        {"concessions", os.Concessions},
+        {"credit_loss", os.CreditLoss},
+        {"management_fee", os.ManagementFee},
+    }
+}
+
+// IsSupplied returns if any line of the operating statement is used.
+func (os OperatingStatement) IsSupplied () bool {
+    for _, al := range os.amount_lines() {
+        if al.line.is_supplied() {
+            return true
+        }
+    }
+    for _, rl := range os.rate_lines() {
+        if rl.line.is_supplied() {
+            return true
+        }
+    }
+    return false
+}
+
+// Validate checks every line of the operating statement.
+func (os OperatingStatement) Validate () error {
+    for _, al := range os.amount_lines() {
+        err := al.line.validate(al.field)
+        if err != nil {
+            return err
+        }
+    }
+    for _, rl := range os.rate_lines() {
+        err := rl.line.validate(rl.field)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Projection returns the operating statement of every year. When the gross
+// potential rent of every year is given, like the one of a rent roll, it is
+// used instead of the gross potential rent line.
+func (os OperatingStatement) Projection (years int, gross_potential_rent []ff.Money) ([]OperatingYear, error) {
+    err := os.Validate()
+    if err != nil {
+        return nil, err
+    }
+    if gross_potential_rent == nil {
+        if !os.GrossPotentialRent.is_supplied() {
+            return nil, &ff.ValidationError{Field: "gross_potential_rent", Value: os.GrossPotentialRent, Message: "The gross potential rent is needed without a rent roll"}
+        }
+        gross_potential_rent = os.GrossPotentialRent.projection(years)
+    }
+    if len(gross_potential_rent) < years {
+        return nil, &ff.ValidationError{Field: "gross_potential_rent", Value: gross_potential_rent, Message: "There must be a gross potential rent for every year"}
+    }
+    other_income := os.OtherIncome.projection(years)
+    real_estate_taxes := os.RealEstateTaxes.projection(years)
+    insurance := os.Insurance.projection(years)
+    utilities := os.Utilities.projection(years)
+    repairs := os.RepairsAndMaintenance.projection(years)
+    payroll := os.Payroll.projection(years)
+
+    statements := make([]OperatingYear, years)
+    for i := range statements {
+        year := OperatingYear{
+            Year: i + 1,
+            GrossPotentialRent: gross_potential_rent[i],
+            OtherIncome: other_income[i],
+            RealEstateTaxes: real_estate_taxes[i],
+            Insurance: insurance[i],
+            Utilities: utilities[i],
+            RepairsAndMaintenance: repairs[i],
+            Payroll: payroll[i],
+        }
+        year.Vacancy = year.GrossPotentialRent.Mul(os.Vacancy.at(i))
+        year.Concessions = year.GrossPotentialRent.Mul(os.Concessions.at(i))
+        year.CreditLoss = year.GrossPotentialRent.Mul(os.CreditLoss.at(i))
+        year.EffectiveGrossIncome = year.GrossPotentialRent -
+            year.Vacancy -
+            year.Concessions -
+            year.CreditLoss +
+            year.OtherIncome
+        year.ManagementFee = year.EffectiveGrossIncome.Mul(os.ManagementFee.at(i))
+        year.TotalExpenses = year.RealEstateTaxes +
+            year.Insurance +
+            year.Utilities +
+            year.RepairsAndMaintenance +
+            year.Payroll +
+            year.ManagementFee
+        year.NOI = year.EffectiveGrossIncome - year.TotalExpenses
+        statements[i] = year
+    }
+    return statements, nil
+}
+
+// spread_months returns the yearly amounts split evenly in the months of every
+// year. Every month is the difference of the rounded accumulated amount of the
+// year, so the months always add up to the year.
+func spread_months (yearly []ff.Money) []ff.Money {
+    monthly := make([]ff.Money, 0, len(yearly) * MONTHS_PER_YEAR)
+    for _, year := range yearly {
+        taken := ff.Money(0)
+        for m := 1; m <= MONTHS_PER_YEAR; m++ {
+            accumulated := year.Mul(float64(m) / MONTHS_PER_YEAR)
+            monthly = append(monthly, accumulated - taken)
+            taken = accumulated
+        }
+    }
+    return monthly
+}
+
+// operating_statement returns the operating statement of the deal for the
+// years of the projection, with the gross potential rent of the rent roll when
+// it is supplied.
+func (deal DealInformation) operating_statement (years int) ([]OperatingYear, error) {
+    var gross_potential_rent []ff.Money
+    if deal.RentRoll.IsSupplied() {
+        var err error
+        gross_potential_rent, _, err = deal.RentRoll.Revenue(years)
+        if err != nil {
+            return nil, err
+        }
+    }
+    return deal.OperatingStatement.Projection(years, gross_potential_rent)
+}
+
+// operating_projection returns the revenue, the operating expenses and the
+// leasing costs of every period of the projection, with 1 or 12 periods per
+// year. With an operating statement the revenue is the EGI and the expenses
+// are the total expenses of every year, split evenly in the months. Otherwise
+// the operating expenses grow with the projected growth, compounded every
+// period.
+func (deal DealInformation) operating_projection (periods int, periods_per_year int) (
+    revenues []ff.Money,
+    expenses []ff.Money,
+    leasing_costs []ff.Money,
+    err error,
+) {
+    revenues, leasing_costs, err = deal.revenue_projection(periods, periods_per_year)
+    if err != nil {
+        return nil, nil, nil, fmt.Errorf("revenue_projection internal error: %w", err)
+    }
+
+    if deal.OperatingStatement.IsSupplied() {
+        years := (periods + periods_per_year - 1) / periods_per_year
+        statements, err := deal.operating_statement(years)
+        if err != nil {
+            return nil, nil, nil, fmt.Errorf("operating_statement internal error: %w", err)
+        }
+        revenues = make([]ff.Money, years)
+        expenses = make([]ff.Money, years)
+        for i, year := range statements {
+            revenues[i] = year.EffectiveGrossIncome
+            expenses[i] = year.TotalExpenses
+        }
+        if periods_per_year != 1 {
+            revenues = spread_months(revenues)
+            expenses = spread_months(expenses)
+        }
+        return revenues[:periods], expenses[:periods], leasing_costs, nil
+    }
+
+    growth, err := ff.EffectiveRate(deal.ProjOperatingExpensesGrowth).Periodic(periods_per_year)
+    if err != nil {
+        return nil, nil, nil, fmt.Errorf("Periodic internal error: %v", err)
+    }
+    expenses = make([]ff.Money, periods)
+    current := deal.InitOperatingExpenses.Div(float64(periods_per_year))
+    for i := range expenses {
+        expenses[i] = current
+        current += current.Mul(growth)
+    }
+    return revenues, expenses, leasing_costs, nil
+}
+
+// SizingNOI returns the NOI of the first year of the operating statement of
+// the deal, the NOI the loan is sized on. Without an operating statement it is
+// the revenue of the first year, the one of the rent roll when it is
+// supplied, less the initial operating expenses.
+func (deal DealInformation) SizingNOI () (ff.Money, error) {
+    if !deal.OperatingStatement.IsSupplied() {
+        revenues, _, err := deal.revenue_projection(1, 1)
+        if err != nil {
+            return 0, err
+        }
+        return revenues[0] - deal.InitOperatingExpenses, nil
+    }
+    statements, err := deal.operating_statement(1)
+    if err != nil {
+        return 0, err
+    }
+    return statements[0].NOI, nil
+}
+
+// SizeLoan returns the loan sized on the NOI of the operating statement of the
+// deal.
+func (deal DealInformation) SizeLoan (loan ls.LoanSizer) (ls.LoanSizer, error) {
+    noi, err := deal.SizingNOI()
+    if err != nil {
+        return loan, fmt.Errorf("SizingNOI internal error: %w", err)
+    }
+    loan.NOI = noi
+    return ls.InitLoanSizer(loan)
+}
+
+// size_loan returns the loan sized on the NOI of the deal when the deal has
+// its own NOI, from an operating statement or a rent roll, otherwise on the
+// NOI of the loan.
+func (deal DealInformation) size_loan (loan ls.LoanSizer) (ls.LoanSizer, error) {
+    if deal.OperatingStatement.IsSupplied() || deal.RentRoll.IsSupplied() {
+        return deal.SizeLoan(loan)
+    }
+    return ls.InitLoanSizer(loan)
+}
@@ -0,0 +1,184 @@
+// Maximum purchase price of a deal, the "what can we pay" solver. The purchase
+// price is searched by bisection, re-sizing the loan with every candidate
+// price, until the highest price that still meets every target return is found
+// to the dollar.
+
+package investment_analysis
+
+import (
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    ls "jacobitosuperstar/LoanSizing/internal/loan_sizer";
+)
+
+// Targets of the TargetReturnOfInvestment.
+const (
+    TargetIRR                       = "internal_rate_of_return"
+    TargetEquityMultiple            = "equity_multiple"
+    TargetAverageCashOnCashReturn   = "average_cash_on_cash_return"
+)
+
+// PurchasePriceSolution is the highest purchase price that meets the targets,
+// the return of the deal at that price and the target that stops a higher
+// price.
+type PurchasePriceSolution struct {
+    PurchasePrice       ff.Money            `json:"purchase_price"`
+    BindingTarget       string              `json:"binding_target"`
+    ReturnOfInvestment  ReturnOfInvestment  `json:"return_of_investment"`
+}
+
+// validate checks that there is at least one target.
+func (target TargetReturnOfInvestment) validate () error {
+    if target.IRR <= 0 && target.EquityMultiple <= 0 && target.AverageCashOnCashReturn <= 0 {
+        return &ff.ValidationError{Field: "target_return_of_investment", Value: target, Message: "There must be at least one target greater than 0"}
+    }
+    return nil
+}
+
+// margins returns how far the return is over every target, relative to the
+// target, in the order of the targets. A target of 0 has no margin.
+func (target TargetReturnOfInvestment) margins (roi ReturnOfInvestment) ([]string, []float64) {
+    var names []string
+    var margins []float64
+    if target.IRR > 0 {
+        names = append(names, TargetIRR)
+        margins = append(margins, roi.IRR / target.IRR - 1)
+    }
+    if target.EquityMultiple > 0 {
+        names = append(names, TargetEquityMultiple)
+        margins = append(margins, roi.EquityMultiple / target.EquityMultiple - 1)
+    }
+    if target.AverageCashOnCashReturn > 0 {
+        names = append(names, TargetAverageCashOnCashReturn)
+        margins = append(margins, roi.AverageCashOnCashReturn / target.AverageCashOnCashReturn - 1)
+    }
+    return names, margins
+}
+
+// meets returns true when the return meets every target.
+func (target TargetReturnOfInvestment) meets (roi ReturnOfInvestment) bool {
+    _, margins := target.margins(roi)
+    for _, margin := range margins {
+        if margin < 0 {
+            return false
+        }
+    }
+    return true
+}
+
+// binding_target returns the target that limits the price, that is the target
+// missed at the higher price with the lowest margin at the solved price.
+func (target TargetReturnOfInvestment) binding_target (solved ReturnOfInvestment, higher ReturnOfInvestment) string {
+    names, solved_margins := target.margins(solved)
+    _, higher_margins := target.margins(higher)
+    binding, binding_margin := "", 0.0
+    for i, name := range names {
+        if higher_margins[i] >= 0 {
+            continue
+        }
+        if binding == "" || solved_margins[i] < binding_margin {
+            binding, binding_margin = name, solved_margins[i]
+        }
+    }
+    return binding
+}
+
+// resized returns the return of the deal with the given metrics and the loan
+// re-sized, on the NOI of the deal when it has one. The project cost of the
+// loan changes with the purchase price.
+func (roi ReturnOfInvestment) resized (
+    taxes TaxAssumptions,
+    deal DealInformation,
+    loan ls.LoanSizer,
+    sale SaleTerms,
+) (ReturnOfInvestment, error) {
+    if loan.ProjectCost > 0 {
+        loan.ProjectCost += deal.PurchasePrice - roi.dealMetrics.PurchasePrice
+    }
+    loan, err := deal.size_loan(loan)
+    if err != nil {
+        return roi, err
+    }
+    return InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+}
+
+// at_purchase_price returns the return of the deal bought at the purchase
+// price, with the loan re-sized on the price.
+func (roi ReturnOfInvestment) at_purchase_price (purchase_price ff.Money) (ReturnOfInvestment, error) {
+    deal := roi.dealMetrics
+    loan := roi.loanMetrics
+    deal.PurchasePrice = purchase_price
+    loan.PropertyValue = purchase_price
+    return roi.resized(roi.taxMetrics, deal, loan, roi.saleMetrics)
+}
+
+// MaximumPurchasePrice returns the highest purchase price of the deal that
+// meets every target of the TargetReturnOfInvestment. The search starts at
+// the purchase price of the deal, and a candidate price whose returns can't be
+// calculated doesn't meet the targets.
+func MaximumPurchasePrice (target TargetReturnOfInvestment, roi ReturnOfInvestment) (PurchasePriceSolution, error) {
+    err := target.validate()
+    if err != nil {
+        return PurchasePriceSolution{}, err
+    }
+    if roi.dealMetrics.PurchasePrice <= 0 {
+        return PurchasePriceSolution{}, &ff.ValidationError{Field: "purchase_price", Value: roi.dealMetrics.PurchasePrice, Message: "The value must be greater than 0"}
+    }
+
+    meets := func (price ff.Money) (ReturnOfInvestment, bool) {
+        candidate, err := roi.at_purchase_price(price)
+        if err != nil {
+            return candidate, false
+        }
+        return candidate, target.meets(candidate)
+    }
+
+    // bracketing the price between a price that meets the targets and one
+    // that doesn't.
+    low, high := roi.dealMetrics.PurchasePrice, roi.dealMetrics.PurchasePrice
+    best, met := meets(low)
+    for met {
+        low = high
+        high *= 2
+        if high > 1000 * roi.dealMetrics.PurchasePrice {
+            return PurchasePriceSolution{}, &ff.ValueError{Field: "purchase_price", Value: high, Message: "The targets are met at any purchase price"}
+        }
+        var candidate ReturnOfInvestment
+        candidate, met = meets(high)
+        if met {
+            best = candidate
+        }
+    }
+    // the deal misses the targets at its own price.
+    if low == high {
+        for !met {
+            high = low
+            low = (low / 2).Floor(ff.Dollar)
+            if low < ff.Dollar {
+                return PurchasePriceSolution{}, &ff.ValueError{Field: "purchase_price", Value: low, Message: "The targets can't be met at any purchase price"}
+            }
+            best, met = meets(low)
+        }
+    }
+
+    for high - low > ff.Dollar {
+        price := ((low + high) / 2).Floor(ff.Dollar)
+        candidate, met := meets(price)
+        if met {
+            low, best = price, candidate
+        } else {
+            high = price
+        }
+    }
+
+    // the binding target is the one that a dollar more misses. When the
+    // returns of a dollar more can't be calculated every target is missed.
+    higher, err := roi.at_purchase_price(high)
+    if err != nil {
+        higher = ReturnOfInvestment{}
+    }
+    return PurchasePriceSolution{
+        PurchasePrice: low,
+        BindingTarget: target.binding_target(best, higher),
+        ReturnOfInvestment: best,
+    }, nil
+}
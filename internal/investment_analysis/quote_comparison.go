@@ -0,0 +1,233 @@
+// Side by side comparison of lender quotes. Every quote is sized against the
+// same property and ranked by proceeds, all-in cost, debt service, balloon and
+// levered IRR, so the table can be handed to the sponsor. Quotes with
+// different compounding are compared by their effective yearly rate.
+
+package investment_analysis
+
+import (
+    "fmt";
+    "sort";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    ls "jacobitosuperstar/LoanSizing/internal/loan_sizer";
+)
+
+// Metrics the quote comparison table can be sorted by.
+const (
+    SortByProceeds      = "proceeds"
+    SortByAllInCost     = "all_in_cost"
+    SortByDebtService   = "debt_service"
+    SortByBalloon       = "balloon"
+    SortByLeveredIRR    = "levered_irr"
+)
+
+// LoanQuote is the term sheet of a lender.
+type LoanQuote struct {
+    Lender              string      `json:"lender"`
+    ls.LoanSizer
+}
+
+// QuoteComparisonRequest has the property shared by all the quotes. When the
+// DealInformation is given, the levered IRR of every quote is calculated over
+// the same hold period, up to the sale year of the SaleTerms.
+type QuoteComparisonRequest struct {
+    PropertyValue       ff.Money            `json:"property_value"`
+    NOI                 ff.Money            `json:"noi"`
+    Quotes              []LoanQuote         `json:"quotes"`
+    DealMetrics         *DealInformation    `json:"deal_information"`
+    TaxMetrics          TaxAssumptions      `json:"tax_assumptions"`
+    SaleMetrics         SaleTerms           `json:"sale_terms"`
+    SortBy              string              `json:"sort_by"`
+}
+
+// QuoteComparisonRow is the sized quote with its metrics and the rank of each
+// metric among the other quotes, 1 being the best.
+type QuoteComparisonRow struct {
+    Lender              string          `json:"lender"`
+    Proceeds            ff.Money        `json:"proceeds"`
+    EffectiveRate       float64         `json:"effective_rate"`
+    AllInCost           float64         `json:"all_in_cost"`
+    DebtService         ff.Money        `json:"debt_service"`
+    Balloon             ff.Money        `json:"balloon"`
+    LeveredIRR          float64         `json:"levered_irr"`
+    ProceedsRank        int             `json:"proceeds_rank"`
+    AllInCostRank       int             `json:"all_in_cost_rank"`
+    DebtServiceRank     int             `json:"debt_service_rank"`
+    BalloonRank         int             `json:"balloon_rank"`
+    LeveredIRRRank      int             `json:"levered_irr_rank,omitempty"`
+    Loan                ls.LoanSizer    `json:"loan"`
+    Error               string          `json:"error,omitempty"`
+}
+
+// QuoteComparison is the table of sized quotes sorted by one of the metrics.
+type QuoteComparison struct {
+    SortedBy            string                  `json:"sorted_by"`
+    Rows                []QuoteComparisonRow    `json:"rows"`
+}
+
+// all_in_cost returns the effective yearly cost of the loan, that is the rate
+// that equals the net proceeds after fees with the debt service and the
+// balloon at the end of the term.
+func all_in_cost (loan ls.LoanSizer) (float64, error) {
+    ppmt, ipmt, err := loan.PaymentDistribution()
+    if err != nil {
+        return 0.0, fmt.Errorf("PaymentDistribution internal error: %v", err)
+    }
+
+    cash_flows := make([]ff.Money, loan.Term + 1)
+    cash_flows[0] = loan.MaximumLoanAmount - loan.MaximumLoanAmount.Mul(loan.LoanOriginationFees)
+    for i := 0; i < loan.Term; i++ {
+        cash_flows[i+1] = ppmt[i] + ipmt[i]
+    }
+    cash_flows[loan.Term] -= loan.BalloonPayment
+
+    cost, err := ff.InternalRateOfReturn(ff.MoneyToFloat64(cash_flows))
+    if err != nil {
+        return 0.0, fmt.Errorf("InternalRateOfReturn internal error: %v", err)
+    }
+    return ff.Round4(cost), nil
+}
+
+// rank_rows sets the rank of a metric of the rows that don't have errors.
+func rank_rows (
+    rows []QuoteComparisonRow,
+    value func(QuoteComparisonRow) float64,
+    higher_is_better bool,
+    set_rank func(*QuoteComparisonRow, int),
+) {
+    var indexes []int
+    for i := range rows {
+        if rows[i].Error == "" {
+            indexes = append(indexes, i)
+        }
+    }
+    sort.SliceStable(indexes, func(i, j int) bool {
+        if higher_is_better {
+            return value(rows[indexes[i]]) > value(rows[indexes[j]])
+        }
+        return value(rows[indexes[i]]) < value(rows[indexes[j]])
+    })
+    for rank, i := range indexes {
+        set_rank(&rows[i], rank + 1)
+    }
+}
+
+// held_loan returns the sized loan held until the sale year, when the balance
+// left is paid off with the sale as the balloon. The loan is sized again with
+// the sale year as its term, keeping the amount sized for the quote.
+func held_loan (loan ls.LoanSizer, sale_year int) (ls.LoanSizer, error) {
+    if loan.Term < sale_year {
+        return loan, &ff.ValidationError{Field: "term", Value: loan.Term, Message: "The term of the loan must reach the sale year"}
+    }
+    loan.Term = sale_year
+    loan.IOPeriod = min(loan.IOPeriod, sale_year)
+    loan.RequestedLoanAmount = loan.MaximumLoanAmount
+    return ls.InitLoanSizer(loan)
+}
+
+// compare_quote sizes a quote against the property and calculates its
+// metrics.
+func compare_quote (request QuoteComparisonRequest, quote LoanQuote) QuoteComparisonRow {
+    row := QuoteComparisonRow{Lender: quote.Lender}
+
+    loan := quote.LoanSizer
+    loan.PropertyValue = request.PropertyValue
+    loan.NOI = request.NOI
+
+    loan, err := ls.InitLoanSizer(loan)
+    row.Loan = loan
+    if err != nil {
+        row.Error = err.Error()
+        return row
+    }
+
+    row.Proceeds = loan.MaximumLoanAmount
+    row.EffectiveRate = ff.Round4(loan.InterestRate().Effective())
+    row.DebtService = loan.LoanPayment
+    row.Balloon = loan.BalloonPayment
+    row.AllInCost, err = all_in_cost(loan)
+    if err != nil {
+        row.Error = err.Error()
+        return row
+    }
+
+    if request.DealMetrics != nil {
+        held, err := held_loan(loan, request.SaleMetrics.SaleYear)
+        if err != nil {
+            row.Error = err.Error()
+            return row
+        }
+        roi := NewReturnOfInvestment(request.TaxMetrics, *request.DealMetrics, held, request.SaleMetrics)
+        roi, err = InitReturnOfInvestment(roi)
+        if err != nil {
+            row.Error = err.Error()
+            return row
+        }
+        row.LeveredIRR = roi.IRR
+    }
+    return row
+}
+
+// CompareLoanQuotes sizes every quote with InitLoanSizer and returns the
+// comparison table sorted by the requested metric. Quotes that can't be sized
+// are kept at the end of the table with their error.
+func CompareLoanQuotes (request QuoteComparisonRequest) (QuoteComparison, error) {
+    if len(request.Quotes) == 0 {
+        return QuoteComparison{}, &ff.ValidationError{Field: "quotes", Value: request.Quotes, Message: "There must be at least one quote"}
+    }
+    if request.DealMetrics != nil && request.SaleMetrics.SaleYear <= 0 {
+        return QuoteComparison{}, &ff.ValidationError{Field: "sale_year", Value: request.SaleMetrics.SaleYear, Message: "The levered IRR needs a sale year greater than 0"}
+    }
+    if request.SortBy == "" {
+        request.SortBy = SortByProceeds
+    }
+
+    rows := make([]QuoteComparisonRow, len(request.Quotes))
+    for i, quote := range request.Quotes {
+        rows[i] = compare_quote(request, quote)
+    }
+
+    rank_rows(rows, func(row QuoteComparisonRow) float64 { return row.Proceeds.Float64() }, true,
+        func(row *QuoteComparisonRow, rank int) { row.ProceedsRank = rank })
+    rank_rows(rows, func(row QuoteComparisonRow) float64 { return row.AllInCost }, false,
+        func(row *QuoteComparisonRow, rank int) { row.AllInCostRank = rank })
+    // debt service is negative, the smaller the payment the better.
+    rank_rows(rows, func(row QuoteComparisonRow) float64 { return row.DebtService.Float64() }, true,
+        func(row *QuoteComparisonRow, rank int) { row.DebtServiceRank = rank })
+    rank_rows(rows, func(row QuoteComparisonRow) float64 { return row.Balloon.Float64() }, false,
+        func(row *QuoteComparisonRow, rank int) { row.BalloonRank = rank })
+    if request.DealMetrics != nil {
+        rank_rows(rows, func(row QuoteComparisonRow) float64 { return row.LeveredIRR }, true,
+            func(row *QuoteComparisonRow, rank int) { row.LeveredIRRRank = rank })
+    }
+
+    var sort_rank func(QuoteComparisonRow) int
+    switch request.SortBy {
+    case SortByProceeds:
+        sort_rank = func(row QuoteComparisonRow) int { return row.ProceedsRank }
+    case SortByAllInCost:
+        sort_rank = func(row QuoteComparisonRow) int { return row.AllInCostRank }
+    case SortByDebtService:
+        sort_rank = func(row QuoteComparisonRow) int { return row.DebtServiceRank }
+    case SortByBalloon:
+        sort_rank = func(row QuoteComparisonRow) int { return row.BalloonRank }
+    case SortByLeveredIRR:
+        if request.DealMetrics == nil {
+            return QuoteComparison{}, &ff.ValidationError{Field: "sort_by", Value: request.SortBy, Message: "The levered IRR needs the deal information"}
+        }
+        sort_rank = func(row QuoteComparisonRow) int { return row.LeveredIRRRank }
+    default:
+        return QuoteComparison{}, &ff.ValidationError{Field: "sort_by", Value: request.SortBy, Message: "The value must be proceeds, all_in_cost, debt_service, balloon or levered_irr"}
+    }
+
+    // rows with errors have no rank and go at the end of the table.
+    sort.SliceStable(rows, func(i, j int) bool {
+        rank_i, rank_j := sort_rank(rows[i]), sort_rank(rows[j])
+        if rank_i == 0 || rank_j == 0 {
+            return rank_j == 0 && rank_i != 0
+        }
+        return rank_i < rank_j
+    })
+
+    return QuoteComparison{SortedBy: request.SortBy, Rows: rows}, nil
+}
@@ -0,0 +1,224 @@
+// Rent roll of a commercial property. The revenue of the property comes from
+// the leases of its tenants, with the contractual escalations of every lease.
+// When a lease expires the space is leased again at the market rent, and the
+// renewal probability blends the renewal with a new tenant: the downtime, the
+// free rent, the tenant improvements (TI) and the leasing commissions are only
+// expected from a new tenant. The rent roll works with whole months, a lease
+// starts on the month of its start date and ends on the month of its end date.
+
+package investment_analysis
+
+import (
+    "fmt";
+    "math";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    "jacobitosuperstar/LoanSizing/internal/utils";
+)
+
+// Lease of a tenant of the rent roll. The rents, the TI and the market rent are
+// yearly amounts per square foot. The leasing commission is the fraction of
+// the base rent of the new lease term paid to the brokers. When the lease
+// expires the space is leased again for the same term as the lease.
+type Lease struct {
+    Tenant              string      `json:"tenant"`
+    SquareFeet          float64     `json:"square_feet"`
+    BaseRent            ff.Money    `json:"base_rent"`
+    Escalation          float64     `json:"escalation"`
+    LeaseStart          utils.Date  `json:"lease_start"`
+    LeaseEnd            utils.Date  `json:"lease_end"`
+    RenewalProbability  float64     `json:"renewal_probability"`
+    MarketRent          ff.Money    `json:"market_rent"`
+    MarketRentGrowth    float64     `json:"market_rent_growth"`
+    DowntimeMonths      int         `json:"downtime_months"`
+    FreeRentMonths      int         `json:"free_rent_months"`
+    TenantImprovements  ff.Money    `json:"tenant_improvements"`
+    LeasingCommission   float64     `json:"leasing_commission"`
+}
+
+// RentRoll has the leases of the property and the date the projection starts.
+type RentRoll struct {
+    StartDate           utils.Date  `json:"start_date"`
+    Leases              []Lease     `json:"leases"`
+}
+
+// IsSupplied returns if the rent roll has leases.
+func (rr RentRoll) IsSupplied () bool {
+    return len(rr.Leases) > 0
+}
+
+// Validate checks the start date and the terms of every lease.
+func (rr RentRoll) Validate () error {
+    if rr.StartDate.IsZero() {
+        return &ff.ValidationError{Field: "start_date", Value: rr.StartDate, Message: "The start date of the projection is needed with a rent roll"}
+    }
+    for _, lease := range rr.Leases {
+        if lease.SquareFeet <= 0 {
+            return &ff.ValidationError{Field: "square_feet", Value: lease.SquareFeet, Message: "The value must be greater than 0"}
+        }
+        if lease.BaseRent < 0 || lease.MarketRent < 0 || lease.TenantImprovements < 0 {
+            return &ff.ValidationError{Field: "base_rent", Value: lease, Message: "The rents and the tenant improvements must be 0 or greater"}
+        }
+        if lease.Escalation <= -1 || lease.MarketRentGrowth <= -1 {
+            return &ff.ValidationError{Field: "escalation", Value: lease, Message: "The escalation and the market rent growth must be greater than -1"}
+        }
+        if lease.LeaseStart.IsZero() || !lease.LeaseEnd.After(lease.LeaseStart.Time) {
+            return &ff.ValidationError{Field: "lease_end", Value: lease.LeaseEnd, Message: "The lease must end after it starts"}
+        }
+        if lease.RenewalProbability < 0 || lease.RenewalProbability > 1 {
+            return &ff.ValidationError{Field: "renewal_probability", Value: lease.RenewalProbability, Message: "The value must be between 0 and 1"}
+        }
+        if lease.DowntimeMonths < 0 || lease.FreeRentMonths < 0 {
+            return &ff.ValidationError{Field: "downtime_months", Value: lease, Message: "The downtime and the free rent months must be 0 or greater"}
+        }
+        if lease.LeasingCommission < 0 || lease.LeasingCommission > 1 {
+            return &ff.ValidationError{Field: "leasing_commission", Value: lease.LeasingCommission, Message: "The value must be between 0 and 1"}
+        }
+    }
+    return nil
+}
+
+// monthly_rent returns the rent of the lease for every month of the
+// projection, the TI and the leasing commissions, negative, on the months the
+// space is leased again, and their monthly amortization over the new lease
+// term.
+func (lease Lease) monthly_rent (start utils.Date, months int) ([]ff.Money, []ff.Money, []ff.Money) {
+    rent := make([]ff.Money, months)
+    leasing_costs := make([]ff.Money, months)
+    amortization := make([]ff.Money, months)
+
+    new_tenant := 1 - lease.RenewalProbability
+    downtime := int(math.Round(float64(lease.DowntimeMonths) * new_tenant))
+    free_rent := int(math.Round(float64(lease.FreeRentMonths) * new_tenant))
+    term := utils.MonthsBetween(lease.LeaseStart, lease.LeaseEnd) + 1
+
+    lease_start := utils.MonthsBetween(start, lease.LeaseStart)
+    base_rent := lease.BaseRent
+    free := 0
+    for lease_start < months {
+        lease_end := lease_start + term
+        for m := max(lease_start + free, 0); m < lease_end && m < months; m++ {
+            // the escalations are on the anniversaries of the lease.
+            years := (m - lease_start) / 12
+            rent[m] = base_rent.Mul(math.Pow(1 + lease.Escalation, float64(years)) * lease.SquareFeet / 12)
+        }
+
+        // the space is leased again at the market rent after the downtime.
+        lease_start = lease_end + downtime
+        if lease_start >= months {
+            break
+        }
+        // the market rent grows from the start of the projection, a space
+        // leased again before it is at today's market rent.
+        base_rent = lease.MarketRent.Mul(math.Pow(1 + lease.MarketRentGrowth, float64(max(lease_start, 0) / 12)))
+        free = free_rent
+        // the leasing costs of an expired lease, leased again before the
+        // projection starts, are already paid.
+        if lease_start < 0 {
+            continue
+        }
+        tenant_improvements := lease.TenantImprovements.Mul(lease.SquareFeet * new_tenant)
+        commission := base_rent.Mul(lease.SquareFeet * float64(term) / 12 * lease.LeasingCommission * new_tenant)
+        leasing_costs[lease_start] -= tenant_improvements + commission
+        // the leasing costs are amortized straight-line over the months of
+        // the new lease.
+        add_deductions(amortization[lease_start:], straight_line(tenant_improvements + commission, float64(term), 1))
+    }
+    return rent, leasing_costs, amortization
+}
+
+// MonthlyRevenue returns the revenue of the rent roll and its leasing costs,
+// negative, for every month of the projection.
+func (rr RentRoll) MonthlyRevenue (months int) ([]ff.Money, []ff.Money, error) {
+    err := rr.Validate()
+    if err != nil {
+        return nil, nil, err
+    }
+    revenue := make([]ff.Money, months)
+    leasing_costs := make([]ff.Money, months)
+    for _, lease := range rr.Leases {
+        rent, costs, _ := lease.monthly_rent(rr.StartDate, months)
+        for m := range revenue {
+            revenue[m] += rent[m]
+            leasing_costs[m] += costs[m]
+        }
+    }
+    return revenue, leasing_costs, nil
+}
+
+// Revenue returns the revenue of the rent roll and its leasing costs,
+// negative, for every year of the projection.
+func (rr RentRoll) Revenue (years int) ([]ff.Money, []ff.Money, error) {
+    monthly_revenue, monthly_leasing_costs, err := rr.MonthlyRevenue(years * 12)
+    if err != nil {
+        return nil, nil, err
+    }
+    revenue := make([]ff.Money, years)
+    leasing_costs := make([]ff.Money, years)
+    for m := range monthly_revenue {
+        revenue[m / 12] += monthly_revenue[m]
+        leasing_costs[m / 12] += monthly_leasing_costs[m]
+    }
+    return revenue, leasing_costs, nil
+}
+
+// MonthlyAmortization returns the amortization of the leasing costs of the
+// rent roll, negative, for every month of the projection. The TI and the
+// leasing commissions of a new lease are amortized over its term, from the
+// month the space is leased again.
+func (rr RentRoll) MonthlyAmortization (months int) ([]ff.Money, error) {
+    err := rr.Validate()
+    if err != nil {
+        return nil, err
+    }
+    amortization := make([]ff.Money, months)
+    for _, lease := range rr.Leases {
+        _, _, lease_amortization := lease.monthly_rent(rr.StartDate, months)
+        for m := range amortization {
+            amortization[m] += lease_amortization[m]
+        }
+    }
+    return amortization, nil
+}
+
+// leasing_amortization returns the amortization of the leasing costs of every
+// period of the projection, with 1 or 12 periods per year. Without a rent roll
+// there are no leasing costs to amortize.
+func (deal DealInformation) leasing_amortization (periods int, periods_per_year int) ([]ff.Money, error) {
+    amortization := make([]ff.Money, periods)
+    if !deal.RentRoll.IsSupplied() {
+        return amortization, nil
+    }
+    monthly_amortization, err := deal.RentRoll.MonthlyAmortization(periods * 12 / periods_per_year)
+    if err != nil {
+        return nil, err
+    }
+    for m := range monthly_amortization {
+        amortization[m * periods_per_year / 12] += monthly_amortization[m]
+    }
+    return amortization, nil
+}
+
+// revenue_projection returns the revenue and the leasing costs of every
+// period of the projection, with 1 or 12 periods per year. Without a rent
+// roll the initial revenue grows with the projected revenue growth, compounded
+// every period, and there are no leasing costs.
+func (deal DealInformation) revenue_projection (periods int, periods_per_year int) ([]ff.Money, []ff.Money, error) {
+    if deal.RentRoll.IsSupplied() {
+        if periods_per_year == 1 {
+            return deal.RentRoll.Revenue(periods)
+        }
+        return deal.RentRoll.MonthlyRevenue(periods)
+    }
+
+    growth, err := ff.EffectiveRate(deal.ProjRevenueGrowth).Periodic(periods_per_year)
+    if err != nil {
+        return nil, nil, fmt.Errorf("Periodic internal error: %v", err)
+    }
+    revenue := make([]ff.Money, periods)
+    current := deal.InitRevenue.Div(float64(periods_per_year))
+    for i := range revenue {
+        revenue[i] = current
+        current += current.Mul(growth)
+    }
+    return revenue, make([]ff.Money, periods), nil
+}
@@ -0,0 +1,168 @@
+// Scenario manager of a deal. The base deal is stored once, and every named
+// scenario only has the fields that it overrides, in the same JSON shape as
+// the base. All the scenarios run in one call and are compared side by side
+// with the base by their loan amount, IRR, equity multiple and DSCR.
+
+package investment_analysis
+
+import (
+    "fmt";
+    "encoding/json";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    ls "jacobitosuperstar/LoanSizing/internal/loan_sizer";
+)
+
+// Scenario is a named case of the deal with the fields that it overrides from
+// the base. The loan is sized again with the overridden terms.
+type Scenario struct {
+    Name                string              `json:"name"`
+    TaxMetrics          json.RawMessage     `json:"tax_assumptions,omitempty"`
+    DealMetrics         json.RawMessage     `json:"deal_information,omitempty"`
+    LoanMetrics         json.RawMessage     `json:"loan_sizer,omitempty"`
+    SaleMetrics         json.RawMessage     `json:"sale_terms,omitempty"`
+}
+
+// ScenarioSet has the base deal and its scenarios.
+type ScenarioSet struct {
+    TaxMetrics          TaxAssumptions      `json:"tax_assumptions"`
+    DealMetrics         DealInformation     `json:"deal_information"`
+    LoanMetrics         ls.LoanSizer        `json:"loan_sizer"`
+    SaleMetrics         SaleTerms           `json:"sale_terms"`
+    Scenarios           []Scenario          `json:"scenarios"`
+}
+
+// ScenarioMetrics are the metrics compared between the scenarios. The DSCR is
+// the one of the first year of the projection.
+type ScenarioMetrics struct {
+    LoanAmount          ff.Money    `json:"loan_amount"`
+    IRR                 float64     `json:"internal_rate_of_return"`
+    EquityMultiple      float64     `json:"equity_multiple"`
+    DSCR                float64     `json:"dscr"`
+}
+
+// ScenarioResult is the return of a scenario, its metrics and their change
+// from the base.
+type ScenarioResult struct {
+    Name                string              `json:"name"`
+    Metrics             ScenarioMetrics     `json:"metrics"`
+    Delta               ScenarioMetrics     `json:"delta"`
+    ReturnOfInvestment  ReturnOfInvestment  `json:"return_of_investment"`
+    Error               string              `json:"error,omitempty"`
+}
+
+// ScenarioComparison is the base and the scenarios side by side.
+type ScenarioComparison struct {
+    Base                ScenarioResult      `json:"base"`
+    Scenarios           []ScenarioResult    `json:"scenarios"`
+}
+
+// override returns a copy of the base with the overridden fields. The base is
+// copied through JSON, so the slices of the base aren't shared with the copy.
+func override[T any] (base T, overrides json.RawMessage) (T, error) {
+    var result T
+    data, err := json.Marshal(base)
+    if err != nil {
+        return result, err
+    }
+    err = json.Unmarshal(data, &result)
+    if err != nil {
+        return result, err
+    }
+    if len(overrides) == 0 {
+        return result, nil
+    }
+    err = json.Unmarshal(overrides, &result)
+    if err != nil {
+        return result, &ff.ValidationError{Field: "overrides", Value: string(overrides), Message: fmt.Sprintf("The overrides are invalid: %v", err)}
+    }
+    return result, nil
+}
+
+// apply returns the base deal with the overrides of the scenario.
+func (scenario Scenario) apply (set ScenarioSet) (TaxAssumptions, DealInformation, ls.LoanSizer, SaleTerms, error) {
+    taxes, err := override(set.TaxMetrics, scenario.TaxMetrics)
+    if err != nil {
+        return taxes, DealInformation{}, ls.LoanSizer{}, SaleTerms{}, err
+    }
+    deal, err := override(set.DealMetrics, scenario.DealMetrics)
+    if err != nil {
+        return taxes, deal, ls.LoanSizer{}, SaleTerms{}, err
+    }
+    loan, err := override(set.LoanMetrics, scenario.LoanMetrics)
+    if err != nil {
+        return taxes, deal, loan, SaleTerms{}, err
+    }
+    sale, err := override(set.SaleMetrics, scenario.SaleMetrics)
+    return taxes, deal, loan, sale, err
+}
+
+// run_scenario sizes the loan of the scenario and calculates its return.
+func run_scenario (set ScenarioSet, scenario Scenario) (ScenarioResult, error) {
+    result := ScenarioResult{Name: scenario.Name}
+    taxes, deal, loan, sale, err := scenario.apply(set)
+    if err != nil {
+        return result, err
+    }
+    loan, err = deal.size_loan(loan)
+    if err != nil {
+        return result, fmt.Errorf("size_loan internal error: %w", err)
+    }
+    roi, err := InitReturnOfInvestment(NewReturnOfInvestment(taxes, deal, loan, sale))
+    if err != nil {
+        return result, fmt.Errorf("InitReturnOfInvestment internal error: %w", err)
+    }
+
+    result.ReturnOfInvestment = roi
+    result.Metrics = ScenarioMetrics{
+        LoanAmount: loan.MaximumLoanAmount,
+        IRR: roi.IRR,
+        EquityMultiple: roi.EquityMultiple,
+    }
+    dscr := roi.DebtServiceCoverage()
+    if len(dscr) > 0 {
+        result.Metrics.DSCR = dscr[0]
+    }
+    return result, nil
+}
+
+// delta returns the change of the metrics from the base.
+func (metrics ScenarioMetrics) delta (base ScenarioMetrics) ScenarioMetrics {
+    return ScenarioMetrics{
+        LoanAmount: metrics.LoanAmount - base.LoanAmount,
+        IRR: ff.Round4(metrics.IRR - base.IRR),
+        EquityMultiple: ff.Round4(metrics.EquityMultiple - base.EquityMultiple),
+        DSCR: ff.Round4(metrics.DSCR - base.DSCR),
+    }
+}
+
+// RunScenarios runs the base deal and every scenario, and returns their metrics
+// with the change from the base. Scenarios that can't be run are kept with
+// their error.
+func RunScenarios (set ScenarioSet) (ScenarioComparison, error) {
+    names := map[string]bool{}
+    for _, scenario := range set.Scenarios {
+        if scenario.Name == "" || names[scenario.Name] {
+            return ScenarioComparison{}, &ff.ValidationError{Field: "name", Value: scenario.Name, Message: "Every scenario needs a unique name"}
+        }
+        names[scenario.Name] = true
+    }
+
+    base, err := run_scenario(set, Scenario{Name: "base"})
+    if err != nil {
+        return ScenarioComparison{}, err
+    }
+    comparison := ScenarioComparison{
+        Base: base,
+        Scenarios: make([]ScenarioResult, len(set.Scenarios)),
+    }
+    for i, scenario := range set.Scenarios {
+        result, err := run_scenario(set, scenario)
+        if err != nil {
+            result.Error = err.Error()
+        } else {
+            result.Delta = result.Metrics.delta(base.Metrics)
+        }
+        comparison.Scenarios[i] = result
+    }
+    return comparison, nil
+}
@@ -0,0 +1,201 @@
+// Two-way sensitivity tables of the returns of a deal. Any two inputs of the
+// deal are varied over lists of values, and every cell of the table is the IRR
+// and the equity multiple of the deal with the pair of values. The inputs are
+// named by the JSON names of their component and field, like
+// "sale_terms.exit_cap_rate" or "loan_sizer.rate". The loan is sized again in
+// every cell, following the purchase price like MaximumPurchasePrice does. The
+// cells are independent, so they are evaluated in parallel.
+
+package investment_analysis
+
+import (
+    "fmt";
+    "sync";
+    "runtime";
+    "strings";
+    "encoding/json";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+)
+
+// Components of the deal whose fields can be varied.
+const (
+    ComponentTaxAssumptions     = "tax_assumptions"
+    ComponentDealInformation    = "deal_information"
+    ComponentLoanSizer          = "loan_sizer"
+    ComponentSaleTerms          = "sale_terms"
+)
+
+// SensitivityInput is an input of the deal and the values it takes.
+type SensitivityInput struct {
+    Input           string      `json:"input"`
+    Values          []float64   `json:"values"`
+}
+
+// SensitivityTable has the IRR and the equity multiple of every pair of values
+// of the inputs, a row for every value of the row input and a column for every
+// value of the column input. Cells that can't be calculated have their error.
+type SensitivityTable struct {
+    Row             SensitivityInput    `json:"row"`
+    Column          SensitivityInput    `json:"column"`
+    IRR             [][]float64         `json:"internal_rate_of_return"`
+    EquityMultiple  [][]float64         `json:"equity_multiple"`
+    Errors          [][]string          `json:"errors,omitempty"`
+}
+
+// split_input returns the component and the field of an input, checking that
+// the field is a number in the JSON of the component.
+func (roi ReturnOfInvestment) split_input (input string) (string, string, error) {
+    component, field, found := strings.Cut(input, ".")
+    var value interface{}
+    switch component {
+    case ComponentTaxAssumptions:
+        value = roi.taxMetrics
+    case ComponentDealInformation:
+        value = roi.dealMetrics
+    case ComponentLoanSizer:
+        value = roi.loanMetrics
+    case ComponentSaleTerms:
+        value = roi.saleMetrics
+    }
+    if !found || value == nil {
+        return "", "", &ff.ValidationError{Field: "input", Value: input, Message: "The input must be tax_assumptions, deal_information, loan_sizer or sale_terms and a field"}
+    }
+
+    data, err := json.Marshal(value)
+    if err != nil {
+        return "", "", err
+    }
+    var fields map[string]json.RawMessage
+    err = json.Unmarshal(data, &fields)
+    if err != nil {
+        return "", "", err
+    }
+    raw, ok := fields[field]
+    if !ok {
+        return "", "", &ff.ValidationError{Field: "input", Value: input, Message: fmt.Sprintf("The %s don't have the field %s", component, field)}
+    }
+    // only the numbers can take the values of the input.
+    var number float64
+    if json.Unmarshal(raw, &number) != nil {
+        return "", "", &ff.ValidationError{Field: "input", Value: input, Message: fmt.Sprintf("The field %s of the %s isn't a number", field, component)}
+    }
+    return component, field, nil
+}
+
+// scenario_with returns the scenario of the deal with the fields set to the
+// values, by component.
+func scenario_with (values map[string]map[string]float64) (Scenario, error) {
+    scenario := Scenario{}
+    for component, fields := range values {
+        data, err := json.Marshal(fields)
+        if err != nil {
+            return scenario, err
+        }
+        switch component {
+        case ComponentTaxAssumptions:
+            scenario.TaxMetrics = data
+        case ComponentDealInformation:
+            scenario.DealMetrics = data
+        case ComponentLoanSizer:
+            scenario.LoanMetrics = data
+        case ComponentSaleTerms:
+            scenario.SaleMetrics = data
+        }
+    }
+    return scenario, nil
+}
+
+// with_inputs returns the return of the deal with the fields set to the values,
+// by component, and the loan sized again.
+func (roi ReturnOfInvestment) with_inputs (values map[string]map[string]float64) (ReturnOfInvestment, error) {
+    scenario, err := scenario_with(values)
+    if err != nil {
+        return roi, err
+    }
+    set := ScenarioSet{
+        TaxMetrics: roi.taxMetrics,
+        DealMetrics: roi.dealMetrics,
+        LoanMetrics: roi.loanMetrics,
+        SaleMetrics: roi.saleMetrics,
+    }
+    taxes, deal, loan, sale, err := scenario.apply(set)
+    if err != nil {
+        return roi, err
+    }
+    // the loan follows the purchase price.
+    if deal.PurchasePrice != roi.dealMetrics.PurchasePrice {
+        loan.PropertyValue = deal.PurchasePrice
+    }
+    return roi.resized(taxes, deal, loan, sale)
+}
+
+// Sensitivity returns the two-way sensitivity table of the IRR and the equity
+// multiple of the deal for the values of the row and the column inputs.
+func (roi ReturnOfInvestment) Sensitivity (row SensitivityInput, column SensitivityInput) (SensitivityTable, error) {
+    row_component, row_field, err := roi.split_input(row.Input)
+    if err != nil {
+        return SensitivityTable{}, err
+    }
+    column_component, column_field, err := roi.split_input(column.Input)
+    if err != nil {
+        return SensitivityTable{}, err
+    }
+    if row.Input == column.Input {
+        return SensitivityTable{}, &ff.ValidationError{Field: "input", Value: row.Input, Message: "The row and the column must be different inputs"}
+    }
+    if len(row.Values) == 0 || len(column.Values) == 0 {
+        return SensitivityTable{}, &ff.ValidationError{Field: "values", Value: row.Input, Message: "Every input needs at least one value"}
+    }
+
+    table := SensitivityTable{
+        Row: row,
+        Column: column,
+        IRR: make([][]float64, len(row.Values)),
+        EquityMultiple: make([][]float64, len(row.Values)),
+    }
+    errors := make([][]string, len(row.Values))
+    for i := range row.Values {
+        table.IRR[i] = make([]float64, len(column.Values))
+        table.EquityMultiple[i] = make([]float64, len(column.Values))
+        errors[i] = make([]string, len(column.Values))
+    }
+
+    // every cell writes only its own position of the table.
+    var wg sync.WaitGroup
+    workers := make(chan struct{}, runtime.NumCPU())
+    for i, row_value := range row.Values {
+        for j, column_value := range column.Values {
+            wg.Add(1)
+            workers <- struct{}{}
+            go func (i int, j int, row_value float64, column_value float64) {
+                defer wg.Done()
+                defer func () { <-workers }()
+                values := map[string]map[string]float64{}
+                values[row_component] = map[string]float64{row_field: row_value}
+                if values[column_component] == nil {
+                    values[column_component] = map[string]float64{}
+                }
+                values[column_component][column_field] = column_value
+
+                cell, err := roi.with_inputs(values)
+                if err != nil {
+                    errors[i][j] = err.Error()
+                    return
+                }
+                table.IRR[i][j] = cell.IRR
+                table.EquityMultiple[i][j] = cell.EquityMultiple
+            }(i, j, row_value, column_value)
+        }
+    }
+    wg.Wait()
+
+    for _, row_errors := range errors {
+        for _, cell_error := range row_errors {
+            if cell_error != "" {
+                table.Errors = errors
+                return table, nil
+            }
+        }
+    }
+    return table, nil
+}
@@ -0,0 +1,422 @@
+// Monte Carlo simulation of the returns of a deal. The growth rates, the exit
+// cap rate, the interest rate and the vacancy are drawn from normal,
+// triangular or uniform distributions, correlated with a Gaussian copula, and
+// the projection runs once for every draw with the loan sized again. The draws
+// are truncated to the range of their variable. The revenue growth is the
+// growth of the gross potential rent and of the other income, so it can't be
+// simulated with a rent roll, and the vacancy needs an operating statement.
+// Every iteration has its own random source derived from the seed and its
+// number, so the results are the same for a seed no matter how the iterations
+// are scheduled between the goroutines.
+
+package investment_analysis
+
+import (
+    "fmt";
+    "math";
+    "sort";
+    "sync";
+    "runtime";
+    "math/rand/v2";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    ls "jacobitosuperstar/LoanSizing/internal/loan_sizer";
+)
+
+// Variables of the deal that can be simulated.
+const (
+    SimulateRevenueGrowth   = "revenue_growth"
+    SimulateExpenseGrowth   = "expense_growth"
+    SimulateExitCapRate     = "exit_cap_rate"
+    SimulateInterestRate    = "interest_rate"
+    SimulateVacancy         = "vacancy"
+)
+
+// Types of distribution of the variables.
+const (
+    DistributionNormal      = "normal"
+    DistributionTriangular  = "triangular"
+    DistributionUniform     = "uniform"
+)
+
+// Distribution of a simulated variable. The normal distribution uses the mean
+// and the standard deviation, the uniform distribution the minimum and the
+// maximum, and the triangular distribution the minimum, the mode and the
+// maximum.
+type Distribution struct {
+    Variable            string      `json:"variable"`
+    Type                string      `json:"type"`
+    Mean                float64     `json:"mean"`
+    StdDev              float64     `json:"std_dev"`
+    Min                 float64     `json:"min"`
+    Mode                float64     `json:"mode"`
+    Max                 float64     `json:"max"`
+}
+
+// Simulation has the distributions of the variables, the correlations between
+// them in the order of the distributions, and the number of iterations. Without
+// correlations the variables are independent. The DSCR covenant defaults to
+// the minimum DSCR of the loan.
+type Simulation struct {
+    Distributions       []Distribution  `json:"distributions"`
+    Correlations        [][]float64     `json:"correlations"`
+    Iterations          int             `json:"iterations"`
+    Seed                uint64          `json:"seed"`
+    DSCRCovenant        float64         `json:"dscr_covenant"`
+}
+
+// Percentiles of a simulated metric.
+type Percentiles struct {
+    P5                  float64     `json:"p5"`
+    P25                 float64     `json:"p25"`
+    P50                 float64     `json:"p50"`
+    P75                 float64     `json:"p75"`
+    P95                 float64     `json:"p95"`
+    Mean                float64     `json:"mean"`
+}
+
+// SimulationResult has the distribution of the IRR and the equity multiple of
+// the iterations, the probability of losing equity, that is an equity multiple
+// under 1, and the probability of a year with the DSCR under the covenant.
+// The iterations whose draws can't be projected are counted as failed, and
+// the rest of the results only use the successful iterations.
+type SimulationResult struct {
+    Iterations          int             `json:"iterations"`
+    FailedIterations    int             `json:"failed_iterations"`
+    IRR                 Percentiles     `json:"internal_rate_of_return"`
+    EquityMultiple      Percentiles     `json:"equity_multiple"`
+    ProbabilityOfLoss   float64         `json:"probability_of_loss"`
+    ProbabilityOfBreach float64         `json:"probability_of_dscr_breach"`
+}
+
+// Bounds of the simulated variables. The draws out of the bounds are truncated
+// to them, so a normal draw can't give a negative vacancy or an exit cap rate
+// of 0.
+var simulation_bounds = map[string][2]float64{
+    SimulateRevenueGrowth:  {-0.99, math.Inf(1)},
+    SimulateExpenseGrowth:  {-0.99, math.Inf(1)},
+    SimulateExitCapRate:    {0.0001, math.Inf(1)},
+    SimulateInterestRate:   {0.0001, math.Inf(1)},
+    SimulateVacancy:        {0, 1},
+}
+
+// iteration_result is the outcome of an iteration.
+type iteration_result struct {
+    irr                 float64
+    equity_multiple     float64
+    breach              bool
+    err                 error
+}
+
+// validate checks the parameters of the distribution.
+func (d Distribution) validate () error {
+    switch d.Variable {
+    case SimulateRevenueGrowth, SimulateExpenseGrowth, SimulateExitCapRate, SimulateInterestRate, SimulateVacancy:
+    default:
+        return &ff.ValidationError{Field: "variable", Value: d.Variable, Message: "The value must be revenue_growth, expense_growth, exit_cap_rate, interest_rate or vacancy"}
+    }
+    switch d.Type {
+    case DistributionNormal:
+        if d.StdDev < 0 {
+            return &ff.ValidationError{Field: "std_dev", Value: d.StdDev, Message: "The value must be 0 or greater"}
+        }
+    case DistributionUniform:
+        if d.Min >= d.Max {
+            return &ff.ValidationError{Field: "max", Value: d.Max, Message: "The maximum must be greater than the minimum"}
+        }
+    case DistributionTriangular:
+        if d.Min >= d.Max || d.Mode < d.Min || d.Mode > d.Max {
+            return &ff.ValidationError{Field: "mode", Value: d.Mode, Message: "The mode must be between the minimum and the maximum, and the maximum greater than the minimum"}
+        }
+    default:
+        return &ff.ValidationError{Field: "type", Value: d.Type, Message: "The value must be normal, triangular or uniform"}
+    }
+    return nil
+}
+
+// truncated returns the value of the draw truncated to the bounds of the
+// variable.
+func (d Distribution) truncated (z float64) float64 {
+    bounds := simulation_bounds[d.Variable]
+    return math.Min(math.Max(d.sample(z), bounds[0]), bounds[1])
+}
+
+// sample returns the value of the distribution for a standard normal draw.
+func (d Distribution) sample (z float64) float64 {
+    if d.Type == DistributionNormal {
+        return d.Mean + d.StdDev * z
+    }
+    // the draw is moved to a uniform draw with the normal CDF.
+    u := 0.5 * math.Erfc(- z / math.Sqrt2)
+    if d.Type == DistributionUniform {
+        return d.Min + u * (d.Max - d.Min)
+    }
+    width := d.Max - d.Min
+    if u < (d.Mode - d.Min) / width {
+        return d.Min + math.Sqrt(u * width * (d.Mode - d.Min))
+    }
+    return d.Max - math.Sqrt((1 - u) * width * (d.Max - d.Mode))
+}
+
+// cholesky returns the lower triangular matrix L of the correlations, where
+// L times its transpose is the correlation matrix.
+func cholesky (correlations [][]float64) ([][]float64, error) {
+    n := len(correlations)
+    lower := make([][]float64, n)
+    for i := range lower {
+        lower[i] = make([]float64, n)
+        for j := 0; j <= i; j++ {
+            sum := correlations[i][j]
+            for k := 0; k < j; k++ {
+                sum -= lower[i][k] * lower[j][k]
+            }
+            if i == j {
+                if sum <= 0 {
+                    return nil, &ff.ValidationError{Field: "correlations", Value: correlations, Message: "The correlation matrix must be positive definite"}
+                }
+                lower[i][i] = math.Sqrt(sum)
+            } else {
+                lower[i][j] = sum / lower[j][j]
+            }
+        }
+    }
+    return lower, nil
+}
+
+// correlation_factor returns the Cholesky factor of the correlations of the
+// simulation, the identity when there are no correlations.
+func (s Simulation) correlation_factor () ([][]float64, error) {
+    n := len(s.Distributions)
+    correlations := s.Correlations
+    if correlations == nil {
+        correlations = make([][]float64, n)
+        for i := range correlations {
+            correlations[i] = make([]float64, n)
+            correlations[i][i] = 1
+        }
+    }
+    if len(correlations) != n {
+        return nil, &ff.ValidationError{Field: "correlations", Value: correlations, Message: "There must be a row for every distribution"}
+    }
+    for i, row := range correlations {
+        if len(row) != n {
+            return nil, &ff.ValidationError{Field: "correlations", Value: correlations, Message: "There must be a column for every distribution"}
+        }
+        if row[i] != 1 {
+            return nil, &ff.ValidationError{Field: "correlations", Value: correlations, Message: "The correlation of a variable with itself must be 1"}
+        }
+        for j, correlation := range row {
+            if correlation < -1 || correlation > 1 || correlation != correlations[j][i] {
+                return nil, &ff.ValidationError{Field: "correlations", Value: correlations, Message: "The correlations must be symmetric and between -1 and 1"}
+            }
+        }
+    }
+    return cholesky(correlations)
+}
+
+// validate checks the iterations, the distributions and the correlations, and
+// returns the Cholesky factor of the correlations. Every variable must change
+// the projection of the deal.
+func (s Simulation) validate (deal DealInformation) ([][]float64, error) {
+    if s.Iterations <= 0 {
+        return nil, &ff.ValidationError{Field: "iterations", Value: s.Iterations, Message: "The value must be greater than 0"}
+    }
+    if len(s.Distributions) == 0 {
+        return nil, &ff.ValidationError{Field: "distributions", Value: s.Distributions, Message: "There must be at least one distribution"}
+    }
+    variables := map[string]bool{}
+    for _, d := range s.Distributions {
+        err := d.validate()
+        if err != nil {
+            return nil, err
+        }
+        if variables[d.Variable] {
+            return nil, &ff.ValidationError{Field: "variable", Value: d.Variable, Message: "Every variable can only have one distribution"}
+        }
+        variables[d.Variable] = true
+        if d.Variable == SimulateVacancy && !deal.OperatingStatement.IsSupplied() {
+            return nil, &ff.ValidationError{Field: "variable", Value: d.Variable, Message: "The vacancy needs an operating statement"}
+        }
+        if d.Variable == SimulateRevenueGrowth && deal.RentRoll.IsSupplied() {
+            return nil, &ff.ValidationError{Field: "variable", Value: d.Variable, Message: "The revenue of a rent roll follows its leases, so the revenue growth can't be simulated"}
+        }
+    }
+    return s.correlation_factor()
+}
+
+// with_draw returns the metrics of the deal with the values drawn for the
+// variables.
+func (roi ReturnOfInvestment) with_draw (values map[string]float64) (TaxAssumptions, DealInformation, ls.LoanSizer, SaleTerms, error) {
+    deal := roi.dealMetrics
+    loan := roi.loanMetrics
+    sale := roi.saleMetrics
+    for variable, value := range values {
+        switch variable {
+        case SimulateRevenueGrowth:
+            deal.ProjRevenueGrowth = value
+            deal.OperatingStatement.GrossPotentialRent.Growth = value
+            deal.OperatingStatement.OtherIncome.Growth = value
+        case SimulateExpenseGrowth:
+            deal.ProjOperatingExpensesGrowth = value
+            for _, line := range []*LineItem{
+                &deal.OperatingStatement.RealEstateTaxes,
+                &deal.OperatingStatement.Insurance,
+                &deal.OperatingStatement.Utilities,
+                &deal.OperatingStatement.RepairsAndMaintenance,
+                &deal.OperatingStatement.Payroll,
+            } {
+                line.Growth = value
+            }
+        case SimulateExitCapRate:
+            sale.ExitCapRate = value
+        case SimulateInterestRate:
+            loan.Rate = value
+        case SimulateVacancy:
+            deal.OperatingStatement.Vacancy = RateItem{Rate: value}
+        }
+    }
+    return roi.taxMetrics, deal, loan, sale, nil
+}
+
+// run_iteration draws the variables of an iteration and projects the deal with
+// them.
+func (roi ReturnOfInvestment) run_iteration (s Simulation, lower [][]float64, covenant float64, iteration int) iteration_result {
+    random := rand.New(rand.NewPCG(s.Seed, uint64(iteration)))
+    independent := make([]float64, len(s.Distributions))
+    for i := range independent {
+        independent[i] = random.NormFloat64()
+    }
+    values := map[string]float64{}
+    for i, d := range s.Distributions {
+        z := 0.0
+        for k := 0; k <= i; k++ {
+            z += lower[i][k] * independent[k]
+        }
+        values[d.Variable] = d.truncated(z)
+    }
+
+    taxes, deal, loan, sale, err := roi.with_draw(values)
+    if err != nil {
+        return iteration_result{err: err}
+    }
+    // the loan is re-sized on the NOI of the drawn deal.
+    loan, err = deal.size_loan(loan)
+    if err != nil {
+        return iteration_result{err: err}
+    }
+    candidate := NewReturnOfInvestment(taxes, deal, loan, sale)
+    candidate.SetAdquisitionCost()
+    err = candidate.SetNetCashFlowProjection()
+    if err != nil {
+        return iteration_result{err: err}
+    }
+    err = candidate.SetEquityMultiple()
+    if err != nil {
+        return iteration_result{err: err}
+    }
+
+    irr, err := candidate.levered_irr()
+    if err != nil {
+        return iteration_result{err: err}
+    }
+    result := iteration_result{equity_multiple: candidate.EquityMultiple, irr: ff.Round4(irr)}
+    result.breach = candidate.breaches_covenant(covenant)
+    return result
+}
+
+// breaches_covenant returns if the DSCR of any year with debt service is under
+// the covenant, the years with a negative NOI included.
+func (roi ReturnOfInvestment) breaches_covenant (covenant float64) bool {
+    dscr := roi.DebtServiceCoverage()
+    for i, year := range roi.NetCashFlowProjection[1:] {
+        debt_service := year["principal_payment"].(ff.Money) + year["interest_payment"].(ff.Money)
+        if debt_service < 0 && dscr[i] < covenant {
+            return true
+        }
+    }
+    return false
+}
+
+// percentiles returns the percentiles of the values, interpolated between the
+// closest ranks, and their mean.
+func percentiles (values []float64) Percentiles {
+    if len(values) == 0 {
+        return Percentiles{}
+    }
+    sorted := append([]float64{}, values...)
+    sort.Float64s(sorted)
+    at := func (p float64) float64 {
+        rank := p * float64(len(sorted) - 1)
+        low := int(math.Floor(rank))
+        high := int(math.Ceil(rank))
+        return ff.Round4(sorted[low] + (rank - float64(low)) * (sorted[high] - sorted[low]))
+    }
+    total := 0.0
+    for _, value := range sorted {
+        total += value
+    }
+    return Percentiles{
+        P5: at(0.05),
+        P25: at(0.25),
+        P50: at(0.50),
+        P75: at(0.75),
+        P95: at(0.95),
+        Mean: ff.Round4(total / float64(len(sorted))),
+    }
+}
+
+// Simulate runs the iterations of the simulation concurrently and returns the
+// distribution of the returns of the deal.
+func (roi ReturnOfInvestment) Simulate (s Simulation) (SimulationResult, error) {
+    lower, err := s.validate(roi.dealMetrics)
+    if err != nil {
+        return SimulationResult{}, err
+    }
+    covenant := s.DSCRCovenant
+    if covenant <= 0 {
+        covenant = roi.loanMetrics.MinDSCR
+    }
+
+    results := make([]iteration_result, s.Iterations)
+    iterations := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < runtime.NumCPU(); w++ {
+        wg.Add(1)
+        go func () {
+            defer wg.Done()
+            for i := range iterations {
+                results[i] = roi.run_iteration(s, lower, covenant, i)
+            }
+        }()
+    }
+    for i := range results {
+        iterations <- i
+    }
+    close(iterations)
+    wg.Wait()
+
+    result := SimulationResult{Iterations: s.Iterations}
+    var irrs, equity_multiples []float64
+    losses, breaches := 0, 0
+    for _, iteration := range results {
+        if iteration.err != nil {
+            result.FailedIterations++
+            continue
+        }
+        irrs = append(irrs, iteration.irr)
+        equity_multiples = append(equity_multiples, iteration.equity_multiple)
+        if iteration.equity_multiple < 1 {
+            losses++
+        }
+        if iteration.breach {
+            breaches++
+        }
+    }
+    if len(irrs) == 0 {
+        return result, &ff.ValueError{Field: "iterations", Value: s.Iterations, Message: fmt.Sprintf("No iteration could be projected: %v", results[0].err)}
+    }
+    result.IRR = percentiles(irrs)
+    result.EquityMultiple = percentiles(equity_multiples)
+    result.ProbabilityOfLoss = ff.Round4(float64(losses) / float64(len(irrs)))
+    result.ProbabilityOfBreach = ff.Round4(float64(breaches) / float64(len(irrs)))
+    return result, nil
+}
@@ -0,0 +1,111 @@
+// Adjusted tax basis of the property. The ledger starts with the purchase price
+// and the capitalized closing costs, adds the capital improvements and takes
+// out the depreciation and the amortization of every year, so at the sale the
+// gain can be split in the section 1245 gain, that is the depreciation taken on
+// the cost segregated personal property, the amortization gain, that is the
+// amortization taken on the TI and the leasing commissions, the unrecaptured
+// section 1250 gain, that is the depreciation taken on the building, and the
+// capital gain.
+
+package investment_analysis
+
+import (
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+)
+
+// TaxBasis is the adjusted tax basis ledger of the property. The amounts are
+// positive, and the accumulated depreciation includes the section 1245
+// depreciation but not the amortization of the leasing costs.
+type TaxBasis struct {
+    OriginalBasis           ff.Money    `json:"original_basis"`
+    CapitalImprovements     ff.Money    `json:"capital_improvements"`
+    AccumulatedDepreciation ff.Money    `json:"accumulated_depreciation"`
+    Section1245Depreciation ff.Money    `json:"section_1245_depreciation"`
+    AccumulatedAmortization ff.Money    `json:"accumulated_amortization"`
+}
+
+// SaleGain is the gain of the sale of the property split by how it is taxed.
+// The taxes are negative like the other cash outflows of the projection, and
+// the recapture tax has the tax of the section 1245, the amortization and the
+// unrecaptured section 1250 gains.
+type SaleGain struct {
+    AmountRealized      ff.Money    `json:"amount_realized"`
+    AdjustedBasis       ff.Money    `json:"adjusted_basis"`
+    TotalGain           ff.Money    `json:"total_gain"`
+    Section1245Gain     ff.Money    `json:"section_1245_gain"`
+    AmortizationGain    ff.Money    `json:"amortization_gain"`
+    UnrecapturedGain    ff.Money    `json:"unrecaptured_section_1250_gain"`
+    CapitalGain         ff.Money    `json:"capital_gain"`
+    RecaptureTax        ff.Money    `json:"depreciation_recapture_tax"`
+    CapitalGainsTax     ff.Money    `json:"capital_gains_tax"`
+}
+
+// NewTaxBasis returns the ledger with the original basis of the property.
+func NewTaxBasis (original_basis ff.Money) TaxBasis {
+    return TaxBasis{OriginalBasis: original_basis}
+}
+
+// AddImprovement adds a capitalized improvement to the basis.
+func (tb *TaxBasis) AddImprovement (amount ff.Money) {
+    tb.CapitalImprovements += amount
+}
+
+// Depreciate takes the depreciation deduction of a year of the building, the
+// section 1250 property, out of the basis.
+func (tb *TaxBasis) Depreciate (deduction ff.Money) {
+    tb.AccumulatedDepreciation += deduction
+}
+
+// DepreciatePersonalProperty takes the depreciation deduction of a year of the
+// cost segregated personal property, the section 1245 property, out of the
+// basis.
+func (tb *TaxBasis) DepreciatePersonalProperty (deduction ff.Money) {
+    tb.AccumulatedDepreciation += deduction
+    tb.Section1245Depreciation += deduction
+}
+
+// Amortize takes the amortization deduction of a year of the TI and the
+// leasing commissions out of the basis.
+func (tb *TaxBasis) Amortize (deduction ff.Money) {
+    tb.AccumulatedAmortization += deduction
+}
+
+// Adjusted returns the adjusted basis of the property.
+func (tb TaxBasis) Adjusted () ff.Money {
+    return tb.OriginalBasis + tb.CapitalImprovements - tb.AccumulatedDepreciation - tb.AccumulatedAmortization
+}
+
+// Sale returns the gain of selling the property for the amount realized, that
+// is the sale price after the costs of the sale. The gain up to the section
+// 1245 depreciation and then up to the amortization is recaptured as ordinary
+// income taxed with the income tax rate, the gain up to the rest of the
+// accumulated depreciation is unrecaptured section 1250 gain taxed with the
+// depreciation recapture rate, and the rest is capital gain. A loss isn't
+// taxed.
+func (tb TaxBasis) Sale (amount_realized ff.Money, taxes TaxAssumptions) SaleGain {
+    gain := SaleGain{
+        AmountRealized: amount_realized,
+        AdjustedBasis: tb.Adjusted(),
+    }
+    gain.TotalGain = gain.AmountRealized - gain.AdjustedBasis
+    if gain.TotalGain <= 0 {
+        return gain
+    }
+    gain.Section1245Gain = tb.Section1245Depreciation
+    if gain.Section1245Gain > gain.TotalGain {
+        gain.Section1245Gain = gain.TotalGain
+    }
+    gain.AmortizationGain = tb.AccumulatedAmortization
+    if gain.AmortizationGain > gain.TotalGain - gain.Section1245Gain {
+        gain.AmortizationGain = gain.TotalGain - gain.Section1245Gain
+    }
+    ordinary_gain := gain.Section1245Gain + gain.AmortizationGain
+    gain.UnrecapturedGain = tb.AccumulatedDepreciation - tb.Section1245Depreciation
+    if gain.UnrecapturedGain > gain.TotalGain - ordinary_gain {
+        gain.UnrecapturedGain = gain.TotalGain - ordinary_gain
+    }
+    gain.CapitalGain = gain.TotalGain - ordinary_gain - gain.UnrecapturedGain
+    gain.RecaptureTax = - ordinary_gain.Mul(taxes.IncomeTaxRate) - gain.UnrecapturedGain.Mul(taxes.DepreciationRecaptureTaxRate)
+    gain.CapitalGainsTax = - gain.CapitalGain.Mul(taxes.CapitalGainsTaxRate)
+    return gain
+}
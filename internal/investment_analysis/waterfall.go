@@ -0,0 +1,282 @@
+// Equity distribution waterfall between the limited partners (LP) and the
+// general partner (GP) of a syndicated deal. The net cash flows of the
+// projection are distributed in order: return of capital and preferred return
+// pari passu to the equity of each class, the GP catch-up, and then the splits
+// of the promote tiers, where every tier starts when the LP reaches its IRR
+// hurdle.
+
+package investment_analysis
+
+import (
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+)
+
+// Types of preferred return.
+const (
+    PreferredReturnCompounding  = "compounding"
+    PreferredReturnSimple       = "simple"
+)
+
+// Classes of the waterfall.
+const (
+    lp_class = iota
+    gp_class
+)
+
+// PromoteTier is the split of the distributions once the LP reaches the IRR
+// hurdle, until it reaches the hurdle of the next tier.
+type PromoteTier struct {
+    IRRHurdle           float64     `json:"irr_hurdle"`
+    GPShare             float64     `json:"gp_share"`
+}
+
+// Waterfall has the equity splits and the distribution terms of the deal.
+// The GP receives the CatchUp share of the distributions after the preferred
+// return until it has the CatchUpTarget share of the profits. Before the first
+// promote tier, the distributions are split by the equity of each class.
+type Waterfall struct {
+    LPEquityShare       float64         `json:"lp_equity_share"`
+    PreferredReturn     float64         `json:"preferred_return"`
+    PreferredReturnType string          `json:"preferred_return_type"`
+    CatchUp             float64         `json:"gp_catch_up"`
+    CatchUpTarget       float64         `json:"gp_catch_up_target"`
+    PromoteTiers        []PromoteTier   `json:"promote_tiers"`
+}
+
+// EquityClass has the cash flows of a class, starting with the adquisition,
+// and what it received from every step of the waterfall.
+type EquityClass struct {
+    CashFlows           []ff.Money  `json:"cash_flows"`
+    Contributions       ff.Money    `json:"contributions"`
+    ReturnOfCapital     ff.Money    `json:"return_of_capital"`
+    PreferredReturn     ff.Money    `json:"preferred_return"`
+    CatchUp             ff.Money    `json:"catch_up"`
+    Promote             ff.Money    `json:"promote"`
+    Distributions       ff.Money    `json:"distributions"`
+    IRR                 float64     `json:"internal_rate_of_return"`
+    EquityMultiple      float64     `json:"equity_multiple"`
+}
+
+// EquityDistribution is what each class receives from the waterfall.
+type EquityDistribution struct {
+    LP                  EquityClass     `json:"lp"`
+    GP                  EquityClass     `json:"gp"`
+}
+
+// Validate checks the equity splits and the distribution terms.
+func (w Waterfall) Validate () error {
+    if w.LPEquityShare <= 0 || w.LPEquityShare > 1 {
+        return &ff.ValidationError{Field: "lp_equity_share", Value: w.LPEquityShare, Message: "The value must be greater than 0 and up to 1"}
+    }
+    if w.PreferredReturn < 0 {
+        return &ff.ValidationError{Field: "preferred_return", Value: w.PreferredReturn, Message: "The value must be 0 or greater"}
+    }
+    if w.PreferredReturnType != "" && w.PreferredReturnType != PreferredReturnCompounding && w.PreferredReturnType != PreferredReturnSimple {
+        return &ff.ValidationError{Field: "preferred_return_type", Value: w.PreferredReturnType, Message: "The value must be compounding or simple"}
+    }
+    if w.CatchUp < 0 || w.CatchUp > 1 {
+        return &ff.ValidationError{Field: "gp_catch_up", Value: w.CatchUp, Message: "The value must be between 0 and 1"}
+    }
+    if w.CatchUp > 0 && (w.CatchUpTarget <= 0 || w.CatchUpTarget >= w.CatchUp) {
+        return &ff.ValidationError{Field: "gp_catch_up_target", Value: w.CatchUpTarget, Message: "The value must be greater than 0 and less than the catch-up"}
+    }
+    for i, tier := range w.PromoteTiers {
+        if tier.GPShare < 0 || tier.GPShare >= 1 {
+            return &ff.ValidationError{Field: "gp_share", Value: tier.GPShare, Message: "The value must be between 0 and 1, without 1"}
+        }
+        if i > 0 && tier.IRRHurdle <= w.PromoteTiers[i-1].IRRHurdle {
+            return &ff.ValidationError{Field: "irr_hurdle", Value: tier.IRRHurdle, Message: "The hurdles of the promote tiers must be increasing"}
+        }
+    }
+    return nil
+}
+
+// split returns the GP part of an amount and the rest for the LP.
+func split (amount ff.Money, gp_share float64) (ff.Money, ff.Money) {
+    gp := amount.Mul(gp_share)
+    return amount - gp, gp
+}
+
+// pro_rata returns how an amount is paid to the classes in proportion to what
+// is owed to each one, without paying more than what is owed.
+func pro_rata (amount ff.Money, owed [2]ff.Money) [2]ff.Money {
+    total := owed[lp_class] + owed[gp_class]
+    if total <= 0 || amount <= 0 {
+        return [2]ff.Money{}
+    }
+    if amount > total {
+        amount = total
+    }
+    _, gp := split(amount, owed[gp_class].Ratio(total))
+    if gp > owed[gp_class] {
+        gp = owed[gp_class]
+    }
+    lp := amount - gp
+    if lp > owed[lp_class] {
+        lp = owed[lp_class]
+        gp = amount - lp
+    }
+    return [2]ff.Money{lp, gp}
+}
+
+// set_returns sets the distributions, the IRR and the equity multiple of the
+// class. A class without contributions has no returns.
+func (ec *EquityClass) set_returns () error {
+    for _, cash_flow := range ec.CashFlows {
+        if cash_flow > 0 {
+            ec.Distributions += cash_flow
+        }
+    }
+    if ec.Contributions <= 0 || ec.Distributions <= 0 {
+        return nil
+    }
+    ec.EquityMultiple = ff.Round4(ec.Distributions.Ratio(ec.Contributions))
+    irr, err := ff.InternalRateOfReturn(ff.MoneyToFloat64(ec.CashFlows))
+    if err != nil {
+        return err
+    }
+    ec.IRR = ff.Round4(irr)
+    return nil
+}
+
+// Distribute returns what each class receives from the net cash flows of a
+// projection, where the first cash flow is the adquisition. Negative cash
+// flows are contributions of both classes by their equity shares.
+func (w Waterfall) Distribute (net_cash_flows []ff.Money) (EquityDistribution, error) {
+    err := w.Validate()
+    if err != nil {
+        return EquityDistribution{}, err
+    }
+    gp_equity_share := 1 - w.LPEquityShare
+
+    classes := [2]*EquityClass{
+        {CashFlows: make([]ff.Money, len(net_cash_flows))},
+        {CashFlows: make([]ff.Money, len(net_cash_flows))},
+    }
+    var capital, preferred, profit [2]ff.Money
+    // the LP balance of every hurdle is what the LP still needs to reach the
+    // IRR of the hurdle.
+    hurdle_balances := make([]ff.Money, len(w.PromoteTiers))
+
+    for t, cash_flow := range net_cash_flows {
+        distribute := func (amounts [2]ff.Money, step *[2]ff.Money, is_profit bool) {
+            for c, amount := range amounts {
+                classes[c].CashFlows[t] += amount
+                step[c] += amount
+                if is_profit {
+                    profit[c] += amount
+                }
+            }
+            // a hurdle that is met stays met, so its balance doesn't compound
+            // below 0 or offset the next contributions.
+            for i := range hurdle_balances {
+                hurdle_balances[i] -= amounts[lp_class]
+                if hurdle_balances[i] < 0 {
+                    hurdle_balances[i] = 0
+                }
+            }
+        }
+
+        if t > 0 {
+            for c := range capital {
+                if w.PreferredReturnType == PreferredReturnSimple {
+                    preferred[c] += capital[c].Mul(w.PreferredReturn)
+                } else {
+                    preferred[c] += (capital[c] + preferred[c]).Mul(w.PreferredReturn)
+                }
+            }
+            for i, tier := range w.PromoteTiers {
+                hurdle_balances[i] += hurdle_balances[i].Mul(tier.IRRHurdle)
+            }
+        }
+
+        if cash_flow < 0 {
+            lp, gp := split(- cash_flow, gp_equity_share)
+            contributions := [2]ff.Money{lp, gp}
+            for c, amount := range contributions {
+                classes[c].CashFlows[t] -= amount
+                classes[c].Contributions += amount
+                capital[c] += amount
+            }
+            for i := range hurdle_balances {
+                hurdle_balances[i] += lp
+            }
+            continue
+        }
+        remaining := cash_flow
+
+        // return of capital
+        var return_of_capital, preferred_return, catch_up, promote [2]ff.Money
+        paid := pro_rata(remaining, capital)
+        distribute(paid, &return_of_capital, false)
+        for c := range capital {
+            capital[c] -= paid[c]
+            remaining -= paid[c]
+        }
+
+        // preferred return
+        paid = pro_rata(remaining, preferred)
+        distribute(paid, &preferred_return, true)
+        for c := range preferred {
+            preferred[c] -= paid[c]
+            remaining -= paid[c]
+        }
+
+        // GP catch-up until the GP has the target share of the profits.
+        if w.CatchUp > 0 && remaining > 0 {
+            total_profit := profit[lp_class] + profit[gp_class]
+            needed := (total_profit.Mul(w.CatchUpTarget) - profit[gp_class]).Div(w.CatchUp - w.CatchUpTarget)
+            if needed > 0 {
+                if needed > remaining {
+                    needed = remaining
+                }
+                lp, gp := split(needed, w.CatchUp)
+                distribute([2]ff.Money{lp, gp}, &catch_up, true)
+                remaining -= needed
+            }
+        }
+
+        // promote tiers, the distributions before the first hurdle are split
+        // by the equity.
+        for i := 0; remaining > 0; i++ {
+            gp_share := gp_equity_share
+            if i > 0 {
+                gp_share = w.PromoteTiers[i-1].GPShare
+            }
+            amount := remaining
+            if i < len(w.PromoteTiers) {
+                if hurdle_balances[i] <= 0 {
+                    continue
+                }
+                needed := hurdle_balances[i].Div(1 - gp_share)
+                if needed < amount {
+                    amount = needed
+                }
+            }
+            lp, gp := split(amount, gp_share)
+            distribute([2]ff.Money{lp, gp}, &promote, true)
+            remaining -= amount
+        }
+
+        for c, class := range classes {
+            class.ReturnOfCapital += return_of_capital[c]
+            class.PreferredReturn += preferred_return[c]
+            class.CatchUp += catch_up[c]
+            class.Promote += promote[c]
+        }
+    }
+
+    for _, class := range classes {
+        err = class.set_returns()
+        if err != nil {
+            return EquityDistribution{}, err
+        }
+    }
+    return EquityDistribution{LP: *classes[lp_class], GP: *classes[gp_class]}, nil
+}
+
+// Waterfall returns what the LP and the GP receive from the net cash flow
+// projection of the deal.
+func (roi ReturnOfInvestment) Waterfall (w Waterfall) (EquityDistribution, error) {
+    return w.Distribute(roi.net_cash_flows())
+}
@@ -0,0 +1,104 @@
+// Lender programs are named presets of loan terms and sizing constraints, so
+// a loan sizing request only needs to name the program and override whatever
+// is different for the deal. The programs are loaded from a JSON file.
+
+package loan_sizer
+
+import (
+    "os";
+    "fmt";
+    "encoding/json";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+)
+
+// LenderProgram has the default terms and limits of a lender program.
+type LenderProgram struct {
+    Name                string      `json:"name"`
+    Description         string      `json:"description"`
+    MaxLTV              float64     `json:"max_ltv"`
+    MinDSCR             float64     `json:"min_dscr"`
+    MinDebtYield        float64     `json:"min_debt_yield"`
+    MaxLTC              float64     `json:"max_ltc"`
+    Amortization        int         `json:"amortization"`
+    Term                int         `json:"term"`
+    IOPeriod            int         `json:"io_period"`
+    Rate                float64     `json:"rate"`
+    RateCompounding     int         `json:"rate_compounding"`
+    PaymentFrequency    int         `json:"payment_frequency"`
+    LoanOriginationFees float64     `json:"loan_origination_fees"`
+    DayCount            ff.DayCount `json:"day_count"`
+    Rounding            ff.RoundingPolicy   `json:"rounding"`
+}
+
+// LenderPrograms are the available lender programs by name.
+type LenderPrograms map[string]LenderProgram
+
+// lender_programs_file is the structure of the lender programs config file.
+type lender_programs_file struct {
+    Programs    []LenderProgram     `json:"programs"`
+}
+
+// LoanSizer returns a LoanSizer with the default terms of the program.
+func (lp LenderProgram) LoanSizer () LoanSizer {
+    return LoanSizer{
+        Program: lp.Name,
+        MaxLTV: lp.MaxLTV,
+        MinDSCR: lp.MinDSCR,
+        MinDebtYield: lp.MinDebtYield,
+        MaxLTC: lp.MaxLTC,
+        Amortization: lp.Amortization,
+        Term: lp.Term,
+        IOPeriod: lp.IOPeriod,
+        Rate: lp.Rate,
+        RateCompounding: lp.RateCompounding,
+        PaymentFrequency: lp.PaymentFrequency,
+        LoanOriginationFees: lp.LoanOriginationFees,
+        DayCount: lp.DayCount,
+        Rounding: lp.Rounding,
+    }
+}
+
+// Terms returns the program with the terms of the loan, that is the program
+// defaults after the loan overrides them.
+func (lp LenderProgram) Terms (loan LoanSizer) LenderProgram {
+    lp.MaxLTV = loan.MaxLTV
+    lp.MinDSCR = loan.MinDSCR
+    lp.MinDebtYield = loan.MinDebtYield
+    lp.MaxLTC = loan.MaxLTC
+    lp.Amortization = loan.Amortization
+    lp.Term = loan.Term
+    lp.IOPeriod = loan.IOPeriod
+    lp.Rate = loan.Rate
+    lp.RateCompounding = loan.RateCompounding
+    lp.PaymentFrequency = loan.PaymentFrequency
+    lp.LoanOriginationFees = loan.LoanOriginationFees
+    lp.DayCount = loan.DayCount
+    lp.Rounding = loan.Rounding
+    return lp
+}
+
+// LoadLenderPrograms reads the lender programs from a JSON config file.
+func LoadLenderPrograms (path string) (LenderPrograms, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("LoadLenderPrograms internal error: %w", err)
+    }
+
+    var config lender_programs_file
+    err = json.Unmarshal(data, &config)
+    if err != nil {
+        return nil, fmt.Errorf("LoadLenderPrograms internal error: %w", err)
+    }
+
+    programs := make(LenderPrograms, len(config.Programs))
+    for _, program := range config.Programs {
+        if program.Name == "" {
+            return nil, &ff.ValidationError{Field: "name", Value: program.Name, Message: "Every lender program must have a name"}
+        }
+        if _, ok := programs[program.Name]; ok {
+            return nil, &ff.ValidationError{Field: "name", Value: program.Name, Message: "The lender program is defined more than once"}
+        }
+        programs[program.Name] = program
+    }
+    return programs, nil
+}
@@ -7,60 +7,276 @@
 // [X] yearly loan payment
 // [X] yearly loan io period payment
 // [X] balloon payment
+// [X] dated amortization schedule
 
 package loan_sizer
 
 import (
     "fmt"
-    "math"
     "sort"
     ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    "jacobitosuperstar/LoanSizing/internal/utils";
 )
 
 // LoanSizer creates a struct that has all the information regarding the loan
 // information.
 type LoanSizer struct {
+    Program             string      `json:"program,omitempty"`
     MaxLTV              float64     `json:"max_ltv"`
     MinDSCR             float64     `json:"min_dscr"`
+    MinDebtYield        float64     `json:"min_debt_yield"`
+    MaxLTC              float64     `json:"max_ltc"`
+    ProjectCost         ff.Money    `json:"project_cost"`
     Amortization        int         `json:"amortization"`
     Term                int         `json:"term"`
     IOPeriod            int         `json:"io_period"`
     Rate                float64     `json:"rate"`
-    PropertyValue       int         `json:"property_value"`
-    NOI                 float64     `json:"noi"`
-    RequestedLoanAmount int         `json:"requested_loan_amount"`
+    RateCompounding     int         `json:"rate_compounding"`
+    PaymentFrequency    int         `json:"payment_frequency"`
+    PropertyValue       ff.Money    `json:"property_value"`
+    NOI                 ff.Money    `json:"noi"`
+    RequestedLoanAmount ff.Money    `json:"requested_loan_amount"`
     LoanOriginationFees float64     `json:"loan_origination_fees"`
+    ClosingDate         utils.Date  `json:"closing_date"`
+    FirstPaymentDate    utils.Date  `json:"first_payment_date"`
+    PaymentDay          int         `json:"payment_day"`
+    DayCount            ff.DayCount `json:"day_count"`
+    Rounding            ff.RoundingPolicy   `json:"rounding"`
     // Calculated fields
     // Private
 
     // Public
-    MaximumLoanAmount   float64     `json:"maximum_loan_amount"`
-    LoanPayment         float64     `json:"yearly_loan_payment"`
-    IOLoanPayment       float64     `json:"yearly_io_loan_payment"`
-    BalloonPayment      float64     `json:"balloon_payment"`
+    MaximumLoanAmount   ff.Money    `json:"maximum_loan_amount"`
+    LoanPayment         ff.Money    `json:"yearly_loan_payment"`
+    IOLoanPayment       ff.Money    `json:"yearly_io_loan_payment"`
+    BalloonPayment      ff.Money    `json:"balloon_payment"`
+    Schedule            []ScheduleRow   `json:"schedule,omitempty"`
 }
 
 // Calculation methods
 
+// InterestRate returns the quoted rate of the loan with its compounding. A rate
+// without compounding compounds with the payments.
+func (ls LoanSizer) InterestRate () ff.InterestRate {
+    if ls.RateCompounding == 0 {
+        return ff.NominalRate(ls.Rate, ls.payments_per_year())
+    }
+    return ff.NominalRate(ls.Rate, ls.RateCompounding)
+}
+
+// payment_rate returns the quoted rate as a yearly rate compounded with the
+// payments, that is the periodic rate of the payments times the payments per
+// year, so it accrues with the day count convention like the quoted rate.
+func (ls LoanSizer) payment_rate () (float64, error) {
+    return ls.rate_compounded(ls.payments_per_year())
+}
+
+// rate_compounded returns the quoted rate as a yearly rate compounded with the
+// given payments per year.
+func (ls LoanSizer) rate_compounded (payments_per_year int) (float64, error) {
+    periodic, err := ls.InterestRate().Periodic(payments_per_year)
+    if err != nil {
+        return 0.0, err
+    }
+    return periodic * float64(payments_per_year), nil
+}
+
+// quoted_rate returns a yearly rate compounded with the payments as a rate
+// with the compounding of the quote.
+func (ls LoanSizer) quoted_rate (rate float64) (float64, error) {
+    quoted, err := ff.NominalRate(rate, ls.payments_per_year()).Convert(ls.InterestRate().Compounding)
+    if err != nil {
+        return 0.0, err
+    }
+    return quoted.Rate, nil
+}
+
 // max_ltv_loan_amount returns the maximum loan amount given the maximum loan
 // to value ratio
-func (ls LoanSizer) max_ltv_loan_amount () float64 {
-    ltv_mla  := math.Floor(ls.MaxLTV * float64(ls.PropertyValue))
+func (ls LoanSizer) max_ltv_loan_amount () ff.Money {
+    ltv_mla  := ls.PropertyValue.Mul(ls.MaxLTV).Floor(ff.Dollar)
     return ltv_mla
 }
 
+// max_debt_yield_loan_amount returns the maximum loan amount given the
+// minimum debt yield
+func (ls LoanSizer) max_debt_yield_loan_amount () ff.Money {
+    dy_mla := ls.NOI.Div(ls.MinDebtYield).Floor(ff.Dollar)
+    return dy_mla
+}
+
+// max_ltc_loan_amount returns the maximum loan amount given the maximum loan
+// to cost ratio
+func (ls LoanSizer) max_ltc_loan_amount () ff.Money {
+    ltc_mla := ls.ProjectCost.Mul(ls.MaxLTC).Floor(ff.Dollar)
+    return ltc_mla
+}
+
 // max_mindscr_loan_amount returns the maximum loan amount given the minimum
-// dscr
-func (ls LoanSizer) max_mindscr_loan_amount () (float64, error) {
-    // monthly_rate := ls.Rate / 12
-    // amoritzation_months := ls.Amortization * 12
-    payment := - ls.NOI / ls.MinDSCR
-    dscr_mla, err := ff.PresentValue(ls.Rate, ls.Amortization, payment, 0, 0)
+// dscr. Full-term interest-only loans are sized on the interest only payment,
+// and amortizing loans on the payments of the payment frequency that add up
+// to the yearly debt service.
+func (ls LoanSizer) max_mindscr_loan_amount () (ff.Money, error) {
+    rate, err := ls.payment_rate()
+    if err != nil {
+        return 0, err
+    }
+
+    if ls.IsInterestOnly() {
+        if rate <= 0 {
+            return 0, &ff.ValidationError{Field: "rate", Value: ls.Rate, Message: "The value must be greater than 0 for interest only loans"}
+        }
+        accrual, err := ff.NominalYearFraction(ls.DayCount)
+        if err != nil {
+            return 0, fmt.Errorf("NominalYearFraction internal error: %v", err)
+        }
+        return ls.NOI.Div(ls.MinDSCR * rate * accrual).Floor(ff.Dollar), nil
+    }
+
+    payments_per_year := ls.payments_per_year()
+    payment := - ls.NOI.Div(ls.MinDSCR * float64(payments_per_year))
+    dscr_mla, err := ls.Rounding.PresentValue(rate / float64(payments_per_year), ls.Amortization * payments_per_year, payment.Float64(), 0, 0)
+
+    if err != nil {
+        return 0, fmt.Errorf("max_mindscr_loan_amount internal error: %v", err)
+    }
+    return ff.NewMoney(dscr_mla).Floor(ff.Dollar), err
+}
+
+// ImpliedRate returns the yearly interest rate implied by a quoted yearly
+// payment on the maximum loan amount, with the compounding of the loan rate.
+// The payment of a full-term interest only loan is all interest, accrued for a
+// year with the day count convention of the loan.
+func (ls LoanSizer) ImpliedRate (payment ff.Money) (float64, error) {
+    if ls.MaximumLoanAmount <= 0 {
+        return 0.0, &ff.ValidationError{Field: "maximum_loan_amount", Value: ls.MaximumLoanAmount, Message: "The value must be greater than 0"}
+    }
+    if ls.IsInterestOnly() {
+        accrual, err := ff.NominalYearFraction(ls.DayCount)
+        if err != nil {
+            return 0.0, fmt.Errorf("NominalYearFraction internal error: %w", err)
+        }
+        return ls.quoted_rate(- payment.Ratio(ls.MaximumLoanAmount) / accrual)
+    }
+    payments_per_year := ls.payments_per_year()
+    rate, err := ff.Rate(ls.Amortization * payments_per_year, payment.Float64() / float64(payments_per_year), ls.MaximumLoanAmount.Float64(), 0, ff.PayEnd)
+    if err != nil {
+        return 0.0, fmt.Errorf("Rate internal error: %v", err)
+    }
+    return ls.quoted_rate(rate * float64(payments_per_year))
+}
 
+// RemainingTerm returns the number of years left to pay off the balance of an
+// assumed loan with the rate and the payments of the loan.
+func (ls LoanSizer) RemainingTerm (balance ff.Money) (float64, error) {
+    if ls.IsInterestOnly() {
+        return 0.0, &ff.ValidationError{Field: "amortization", Value: ls.Amortization, Message: "A full-term interest only loan is never paid off"}
+    }
+    rate, err := ls.payment_rate()
+    if err != nil {
+        return 0.0, err
+    }
+    payments_per_year := float64(ls.payments_per_year())
+    periods, err := ff.NPer(rate / payments_per_year, ls.LoanPayment.Float64() / payments_per_year, balance.Float64(), 0, ff.PayEnd)
     if err != nil {
-        return 0.0, fmt.Errorf("max_mindscr_loan_amount internal error: %v", err)
+        return 0.0, fmt.Errorf("NPer internal error: %v", err)
     }
-    return math.Floor(dscr_mla), err
+    return periods / payments_per_year, nil
+}
+
+// payment_schedule returns the principal and interest payments of the loan for
+// every payment of the term, with the payment frequency of the loan. The IO
+// period comes first, and once the loan is fully amortized the remaining
+// periods of the term have no payments. The interest of every period accrues
+// with the day count convention of the loan, while the amortizing payment
+// stays level, so whatever is left of the balance at the end of the
+// amortization is paid with the last payment.
+func (ls LoanSizer) payment_schedule () (
+    ppmt []ff.Money,
+    ipmt []ff.Money,
+    err error,
+) {
+    return ls.periodic_payment_schedule(ls.period_months())
+}
+
+// periodic_payment_schedule returns the principal and interest payments of
+// the loan for every period of the term, with a payment every given months.
+func (ls LoanSizer) periodic_payment_schedule (months int) (
+    ppmt []ff.Money,
+    ipmt []ff.Money,
+    err error,
+) {
+    payments_per_year := 12 / months
+    term := ls.Term * payments_per_year
+    amortization := ls.Amortization * payments_per_year
+    ppmt = make([]ff.Money, 0, term)
+    ipmt = make([]ff.Money, 0, term)
+
+    accruals, err := ls.accrual_fractions(months)
+    if err != nil {
+        return ppmt, ipmt, fmt.Errorf("accrual_fractions internal error: %v", err)
+    }
+    rate, err := ls.rate_compounded(payments_per_year)
+    if err != nil {
+        return ppmt, ipmt, err
+    }
+    // the rate of a period, accrued with the accrual fraction of a period.
+    rate /= float64(payments_per_year)
+
+    io_periods := ls.IOPeriod * payments_per_year
+    if ls.IsInterestOnly() || io_periods > term {
+        io_periods = term
+    }
+    // adding the IO period payments at the begining of the slices.
+    for i := 0; i < io_periods; i++ {
+        interest, err := ls.Rounding.AccruedInterest(rate, ls.MaximumLoanAmount, accruals[i])
+        if err != nil {
+            return ppmt, ipmt, fmt.Errorf("AccruedInterest internal error: %w", err)
+        }
+        ppmt = append(ppmt, 0)
+        ipmt = append(ipmt, interest)
+    }
+
+    if !ls.IsInterestOnly() && io_periods < term {
+        // only the amortizing periods inside the term are needed.
+        amortizing_periods := amortization
+        if io_periods + amortizing_periods > term {
+            amortizing_periods = term - io_periods
+        }
+        amortizing_ipmt, amortizing_ppmt, err := ls.Rounding.AccruedPayments(rate, amortization, ls.MaximumLoanAmount, accruals[io_periods:io_periods + amortizing_periods])
+        if err != nil {
+            return ppmt, ipmt, fmt.Errorf("AccruedPayments internal error: %v", err)
+        }
+        // the last payment pays off the balance of a fully amortizing loan.
+        if amortizing_periods == amortization {
+            capital := ls.MaximumLoanAmount
+            for _, principal_payment := range amortizing_ppmt {
+                capital += principal_payment
+            }
+            amortizing_ppmt[amortizing_periods-1] -= capital
+        }
+        ppmt = append(ppmt, amortizing_ppmt...)
+        ipmt = append(ipmt, amortizing_ipmt...)
+    }
+
+    // the loan is paid off before the end of the term.
+    for len(ppmt) < term {
+        ppmt = append(ppmt, 0)
+        ipmt = append(ipmt, 0)
+    }
+    return ppmt, ipmt, nil
+}
+
+// IsInterestOnly returns true when the loan doesn't amortize during the term,
+// that is a full-term interest-only loan.
+func (ls LoanSizer) IsInterestOnly () bool {
+    return ls.Amortization == 0
+}
+
+// IsFullyAmortizing returns true when the loan is paid off before or at the
+// end of the term.
+func (ls LoanSizer) IsFullyAmortizing () bool {
+    return !ls.IsInterestOnly() && ls.IOPeriod + ls.Amortization <= ls.Term
 }
 
 // Setter methods
@@ -70,113 +286,187 @@ func (ls *LoanSizer) SetMaximumLoanAmount () error {
     max_mindscr_loan_amount, err := ls.max_mindscr_loan_amount()
 
     if err != nil {
-        ls.MaximumLoanAmount = 0.0
+        ls.MaximumLoanAmount = 0
         return fmt.Errorf("ls.max_mindscr_loan_amount internal error: %v", err)
     }
 
-    loan_values := [3]float64{
+    loan_values := []ff.Money{
         ls.max_ltv_loan_amount(),
         max_mindscr_loan_amount,
-        float64(ls.RequestedLoanAmount),
+        ls.RequestedLoanAmount,
+    }
+    // the debt yield and loan to cost constraints are optional.
+    if ls.MinDebtYield > 0 {
+        loan_values = append(loan_values, ls.max_debt_yield_loan_amount())
     }
-    sort.Float64s(loan_values[:])
+    if ls.MaxLTC > 0 && ls.ProjectCost > 0 {
+        loan_values = append(loan_values, ls.max_ltc_loan_amount())
+    }
+    sort.Slice(loan_values, func(i, j int) bool { return loan_values[i] < loan_values[j] })
     ls.MaximumLoanAmount = loan_values[0]
     return nil
 }
 
-// SetIOLoanPayment sets the loan payments during the IO periods
-func (ls *LoanSizer) SetIOLoanPayment () {
-    ls.IOLoanPayment = ff.IOPayment(ls.Rate, ls.MaximumLoanAmount)
+// SetIOLoanPayment sets the loan payments during the IO periods, accrued for
+// a year with the day count convention of the loan.
+func (ls *LoanSizer) SetIOLoanPayment () error {
+    rate, err := ls.payment_rate()
+    if err != nil {
+        ls.IOLoanPayment = 0
+        return err
+    }
+    accrual, err := ff.NominalYearFraction(ls.DayCount)
+    if err != nil {
+        ls.IOLoanPayment = 0
+        return fmt.Errorf("NominalYearFraction internal error: %v", err)
+    }
+    ls.IOLoanPayment, err = ls.Rounding.AccruedInterest(rate, ls.MaximumLoanAmount, accrual)
+    if err != nil {
+        ls.IOLoanPayment = 0
+        return fmt.Errorf("AccruedInterest internal error: %w", err)
+    }
+    return nil
 }
 
-// SetLoanPayment sets the yearly loan payments for the maximum amount
+// SetLoanPayment sets the yearly loan payments for the maximum amount, the
+// level payment of the payment frequency times the payments in a year. On
+// full-term interest-only loans the loan payment is the interest only payment.
 func (ls *LoanSizer) SetLoanPayment () error {
-    loan_payment, err := ff.Payment(ls.Rate, ls.Amortization, ls.MaximumLoanAmount, 0, 0)
+    if ls.IsInterestOnly() {
+        ls.LoanPayment = ls.IOLoanPayment
+        return nil
+    }
+    rate, err := ls.payment_rate()
+    if err != nil {
+        return err
+    }
+    payments_per_year := ls.payments_per_year()
+    loan_payment, err := ls.Rounding.Payment(rate / float64(payments_per_year), ls.Amortization * payments_per_year, ls.MaximumLoanAmount.Float64(), 0, 0)
     if err != nil {
         return fmt.Errorf("Payment internal error: %v", err)
     }
-    ls.LoanPayment = loan_payment
+    periodic_payment, err := ls.Rounding.Money(loan_payment)
+    if err != nil {
+        return fmt.Errorf("Money internal error: %w", err)
+    }
+    ls.LoanPayment = periodic_payment * ff.Money(payments_per_year)
     return nil
 }
 
 // SetBallonPayment sets the balloon payment at the end of the term
 func (ls *LoanSizer) SetBalloonPayment () error {
-    principal_payments, err := ff.PrincipalPayments(ls.Rate, ls.Amortization, ls.MaximumLoanAmount, 0, 0)
-
-    if err != nil {
-        ls.BalloonPayment = 0.0
-        return fmt.Errorf("PrincipalPayments internal error: %v", err)
+    if ls.IsFullyAmortizing() {
+        ls.BalloonPayment = 0
+        return nil
     }
 
-    // here we create a 0s array and then append to it the principal payments
-    // array that will represent the no principal payment whiel the IO period.
-    if ls.IOPeriod > 0 {
-        io_period_ppmt := make([]float64, ls.IOPeriod)
-        principal_payments = append(io_period_ppmt, principal_payments...)
+    principal_payments, _, err := ls.payment_schedule()
+
+    if err != nil {
+        ls.BalloonPayment = 0
+        return fmt.Errorf("payment_schedule internal error: %v", err)
     }
 
     capital := ls.MaximumLoanAmount
-    // There is no need to create a new slice that will contain only the term
-    // as the iteration will iterate till the term value. Genious move!!.
-    for i:=0; i < ls.Term; i++ {
-        capital += principal_payments[i]
+    for _, principal_payment := range principal_payments {
+        capital += principal_payment
     }
-    capital = ff.Round2(capital)
     ls.BalloonPayment = capital
     return nil
 }
 
-// PaymentDistribution returns the slices of the different interest and
-// principal payments of the loan
-func (ls *LoanSizer) PaymentDistribution () (
-    ppmt []float64,
-    ipmt []float64,
+// periodic_distribution returns the principal and interest payments of the
+// loan added up in every period of the term, with 1 or 12 periods per year.
+// Every payment of the payment frequency falls in the period it is paid, so a
+// period without a payment has none.
+func (ls LoanSizer) periodic_distribution (periods_per_year int) (
+    ppmt []ff.Money,
+    ipmt []ff.Money,
     err error,
 ) {
-    // Principal Payments
-    ppmt, err = ff.PrincipalPayments(ls.Rate, ls.Amortization, ls.MaximumLoanAmount, 0, 0)
+    payments_ppmt, payments_ipmt, err := ls.payment_schedule()
     if err != nil {
-        return ppmt, ipmt, fmt.Errorf("PrincipalPayments internal error: %v", err)
-    }
-    // adding the IO period payments at the begining of the slice.
-    if ls.IOPeriod > 0 {
-        io_period_ppmt := make([]float64, ls.IOPeriod)
-        ppmt = append(io_period_ppmt, ppmt...)
+        return ppmt, ipmt, fmt.Errorf("payment_schedule internal error: %v", err)
     }
-    // taking the slice with the size of the term.
-    ppmt = ppmt[:ls.Term]
-
-    // Interest Payments
-    ipmt, err = ff.InterestPayments(ls.Rate, ls.Amortization, ls.MaximumLoanAmount, 0, 0)
-    if err != nil {
-        return ppmt, ipmt, fmt.Errorf("InterestPayments internal error: %v", err)
+    ppmt = make([]ff.Money, ls.Term * periods_per_year)
+    ipmt = make([]ff.Money, ls.Term * periods_per_year)
+    for i := range payments_ppmt {
+        // the month of the term the payment is paid, starting at 1.
+        month := (i + 1) * ls.period_months()
+        period := (month * periods_per_year - 1) / 12
+        ppmt[period] += payments_ppmt[i]
+        ipmt[period] += payments_ipmt[i]
     }
-    // adding the IO period payments at the begining of the slice.
-    if ls.IOPeriod > 0 {
-        io_period_ipmt := make([]float64, ls.IOPeriod)
-        for i := 0; i < ls.IOPeriod; i++ {
-            io_period_ipmt[i] = ls.IOLoanPayment
-        }
-        ipmt = append(io_period_ipmt, ipmt...)
-    }
-    // taking the slice with the size of the term.
-    ipmt = ipmt[:ls.Term]
-
     return ppmt, ipmt, nil
 }
 
+// PaymentDistribution returns the slices of the different interest and
+// principal payments of the loan for every year of the term, adding up the
+// payments of the payment frequency in the year.
+func (ls *LoanSizer) PaymentDistribution () (
+    ppmt []ff.Money,
+    ipmt []ff.Money,
+    err error,
+) {
+    return ls.periodic_distribution(1)
+}
+
+// MonthlyPaymentDistribution returns the slices of the interest and principal
+// payments of the loan for every month of the term, with the payments of the
+// payment frequency in the months they are paid. The payments add up to the
+// yearly payments and to the balloon of the loan.
+func (ls *LoanSizer) MonthlyPaymentDistribution () (
+    ppmt []ff.Money,
+    ipmt []ff.Money,
+    err error,
+) {
+    return ls.periodic_distribution(12)
+}
 
 // InitLoanSizer returns the LoanSizer struct with all the calculated
 // properties
 func InitLoanSizer (ls LoanSizer) (LoanSizer, error){
     var err error
+    if ls.Amortization < 0 {
+        return ls, &ff.ValidationError{Field: "amortization", Value: ls.Amortization, Message: "The value must be 0 (full-term interest only) or greater"}
+    }
+    if ls.Term <= 0 {
+        return ls, &ff.ValidationError{Field: "term", Value: ls.Term, Message: "The value must be greater than 0"}
+    }
+    if ls.IOPeriod < 0 || ls.IOPeriod > ls.Term {
+        return ls, &ff.ValidationError{Field: "io_period", Value: ls.IOPeriod, Message: "The value must be between 0 and the term"}
+    }
+    if ls.MaxLTC > 0 && ls.ProjectCost <= 0 {
+        return ls, &ff.ValidationError{Field: "project_cost", Value: ls.ProjectCost, Message: "The project cost is needed with a maximum loan to cost"}
+    }
+    err = ls.validate_payment_frequency()
+    if err != nil {
+        return ls, err
+    }
+    err = ls.validate_dates()
+    if err != nil {
+        return ls, err
+    }
+    err = ls.Rounding.Validate()
+    if err != nil {
+        return ls, err
+    }
+    if ls.RateCompounding != 0 {
+        err = ls.InterestRate().Validate()
+        if err != nil {
+            return ls, err
+        }
+    }
     // max loan amount
     err = ls.SetMaximumLoanAmount()
     if err != nil {
         return ls, err
     }
     // interest only payment
-    ls.SetIOLoanPayment()
+    err = ls.SetIOLoanPayment()
+    if err != nil {
+        return ls, err
+    }
     // loan payment
     err = ls.SetLoanPayment()
     if err != nil {
@@ -187,5 +477,10 @@ func InitLoanSizer (ls LoanSizer) (LoanSizer, error){
     if err != nil {
         return ls, err
     }
+    // dated amortization schedule
+    err = ls.SetSchedule()
+    if err != nil {
+        return ls, err
+    }
     return ls, nil
 }
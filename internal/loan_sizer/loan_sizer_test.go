@@ -0,0 +1,620 @@
+// Testing of the Loan Sizer
+// TODO: Tests needed
+// [X] Full-term interest only loans
+// [X] Fully amortizing loans inside the term
+// [X] Balloon loans
+// [X] Dated schedules with stub interest
+// [X] Day count conventions
+// [X] Payment frequency
+
+package loan_sizer
+import (
+    "time";
+    "errors";
+    "testing";
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    "jacobitosuperstar/LoanSizing/internal/utils";
+)
+
+func TestInitLoanSizer(t *testing.T) {
+    var testCases = []struct {
+        name string
+        input LoanSizer
+        wantMaximumLoanAmount ff.Money
+        wantLoanPayment ff.Money
+        wantBalloonPayment ff.Money
+    }{
+        {
+            name: "Full-term interest only, DSCR constrained",
+            input: LoanSizer{
+                MaxLTV: 0.80,
+                MinDSCR: 1.25,
+                Amortization: 0,
+                Term: 10,
+                Rate: 0.05,
+                PropertyValue: 2500000 * ff.Dollar,
+                NOI: 100000 * ff.Dollar,
+                RequestedLoanAmount: 10000000 * ff.Dollar,
+            },
+            wantMaximumLoanAmount: 1600000 * ff.Dollar,
+            wantLoanPayment: -80000 * ff.Dollar,
+            wantBalloonPayment: 1600000 * ff.Dollar,
+        },
+        {
+            name: "Full-term interest only, LTV constrained",
+            input: LoanSizer{
+                MaxLTV: 0.75,
+                MinDSCR: 1.25,
+                Amortization: 0,
+                Term: 10,
+                IOPeriod: 2,
+                Rate: 0.05,
+                PropertyValue: 2000000 * ff.Dollar,
+                NOI: 100000 * ff.Dollar,
+                RequestedLoanAmount: 10000000 * ff.Dollar,
+            },
+            wantMaximumLoanAmount: 1500000 * ff.Dollar,
+            wantLoanPayment: -75000 * ff.Dollar,
+            wantBalloonPayment: 1500000 * ff.Dollar,
+        },
+        {
+            name: "Fully amortizing before the end of the term",
+            input: LoanSizer{
+                MaxLTV: 0.75,
+                MinDSCR: 1.25,
+                Amortization: 5,
+                Term: 10,
+                Rate: 0.05,
+                PropertyValue: 2000000 * ff.Dollar,
+                NOI: 500000 * ff.Dollar,
+                RequestedLoanAmount: 150000 * ff.Dollar,
+            },
+            wantMaximumLoanAmount: 150000 * ff.Dollar,
+            wantLoanPayment: -3464622 * ff.Cent,
+            wantBalloonPayment: 0 * ff.Dollar,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, err := InitLoanSizer(test.input)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if got.MaximumLoanAmount != test.wantMaximumLoanAmount {
+                t.Errorf("MaximumLoanAmount got: %v, wanted: %v", got.MaximumLoanAmount, test.wantMaximumLoanAmount)
+            }
+            if got.LoanPayment != test.wantLoanPayment {
+                t.Errorf("LoanPayment got: %v, wanted: %v", got.LoanPayment, test.wantLoanPayment)
+            }
+            if got.BalloonPayment != test.wantBalloonPayment {
+                t.Errorf("BalloonPayment got: %v, wanted: %v", got.BalloonPayment, test.wantBalloonPayment)
+            }
+
+            ppmt, ipmt, err := got.PaymentDistribution()
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if len(ppmt) != got.Term || len(ipmt) != got.Term {
+                t.Errorf("got: %d and %d payments, wanted: %d", len(ppmt), len(ipmt), got.Term)
+            }
+        })
+    }
+}
+
+func TestIOPeriodValidation(t *testing.T) {
+    var testCases = []struct {
+        name string
+        ioPeriod int
+    }{
+        {
+            name: "Negative IO period",
+            ioPeriod: -1,
+        },
+        {
+            name: "IO period longer than the term",
+            ioPeriod: 11,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            _, err := InitLoanSizer(LoanSizer{
+                MaxLTV: 0.75,
+                MinDSCR: 1.25,
+                Amortization: 30,
+                Term: 10,
+                IOPeriod: test.ioPeriod,
+                Rate: 0.05,
+                PropertyValue: 2000000 * ff.Dollar,
+                NOI: 150000 * ff.Dollar,
+                RequestedLoanAmount: 1000000 * ff.Dollar,
+            })
+            var validationError *ff.ValidationError
+            if !errors.As(err, &validationError) || validationError.Field != "io_period" {
+                t.Errorf("got: %v, wanted a validation error for io_period", err)
+            }
+        })
+    }
+}
+
+func TestPaymentDistributionAfterPayoff(t *testing.T) {
+    loan, err := InitLoanSizer(LoanSizer{
+        MaxLTV: 0.75,
+        MinDSCR: 1.25,
+        Amortization: 3,
+        Term: 6,
+        IOPeriod: 1,
+        Rate: 0.05,
+        PropertyValue: 2000000 * ff.Dollar,
+        NOI: 500000 * ff.Dollar,
+        RequestedLoanAmount: 110000 * ff.Dollar,
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    ppmt, ipmt, err := loan.PaymentDistribution()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if ppmt[0] != 0 || ipmt[0] != loan.IOLoanPayment {
+        t.Errorf("IO period got: %v and %v, wanted: 0 and %v", ppmt[0], ipmt[0], loan.IOLoanPayment)
+    }
+    for i := loan.IOPeriod + loan.Amortization; i < loan.Term; i++ {
+        if ppmt[i] != 0 || ipmt[i] != 0 {
+            t.Errorf("period %d got: %v and %v, wanted: 0 and 0", i, ppmt[i], ipmt[i])
+        }
+    }
+}
+
+func TestDebtYieldAndLTCConstraints(t *testing.T) {
+    var testCases = []struct {
+        name string
+        input LoanSizer
+        want ff.Money
+    }{
+        {
+            name: "Debt yield constrained",
+            input: LoanSizer{
+                MaxLTV: 0.75,
+                MinDSCR: 1.00,
+                MinDebtYield: 0.10,
+                Amortization: 0,
+                Term: 3,
+                Rate: 0.05,
+                PropertyValue: 2000000 * ff.Dollar,
+                NOI: 100000 * ff.Dollar,
+                RequestedLoanAmount: 10000000 * ff.Dollar,
+            },
+            want: 1000000 * ff.Dollar,
+        },
+        {
+            name: "Loan to cost constrained",
+            input: LoanSizer{
+                MaxLTV: 0.75,
+                MinDSCR: 1.00,
+                MaxLTC: 0.50,
+                ProjectCost: 1800000 * ff.Dollar,
+                Amortization: 0,
+                Term: 3,
+                Rate: 0.05,
+                PropertyValue: 2000000 * ff.Dollar,
+                NOI: 100000 * ff.Dollar,
+                RequestedLoanAmount: 10000000 * ff.Dollar,
+            },
+            want: 900000 * ff.Dollar,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            got, err := InitLoanSizer(test.input)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if got.MaximumLoanAmount != test.want {
+                t.Errorf("got: %v, wanted: %v", got.MaximumLoanAmount, test.want)
+            }
+        })
+    }
+}
+
+func TestLoadLenderPrograms(t *testing.T) {
+    programs, err := LoadLenderPrograms("../../config/lender_programs.json")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    for _, name := range []string{"agency-multifamily", "cmbs-conduit", "bank-balance-sheet", "bridge"} {
+        program, ok := programs[name]
+        if !ok {
+            t.Errorf("missing lender program: %s", name)
+            continue
+        }
+        if got := program.LoanSizer(); got.Program != name || got.Term != program.Term {
+            t.Errorf("got: %+v, wanted the terms of %s", got, name)
+        }
+    }
+
+    if programs["agency-multifamily"].DayCount != ff.DayCountActual360 {
+        t.Errorf("got: %v, wanted: %v", programs["agency-multifamily"].DayCount, ff.DayCountActual360)
+    }
+
+    // the bridge program is sized on cost, so it needs the project cost.
+    bridge := programs["bridge"].LoanSizer()
+    bridge.PropertyValue = 2000000 * ff.Dollar
+    bridge.NOI = 150000 * ff.Dollar
+    bridge.RequestedLoanAmount = 1500000 * ff.Dollar
+    var validationError *ff.ValidationError
+    if _, err := InitLoanSizer(bridge); !errors.As(err, &validationError) {
+        t.Errorf("got: %v, wanted a validation error for the project cost", err)
+    }
+    bridge.ProjectCost = 1800000 * ff.Dollar
+    if _, err := InitLoanSizer(bridge); err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+    // the terms of the program are the ones after the overrides.
+    bridge.Term = 5
+    terms := programs["bridge"].Terms(bridge)
+    if terms.Term != 5 || terms.Name != "bridge" || terms.MaxLTC != programs["bridge"].MaxLTC {
+        t.Errorf("got: %+v, wanted the bridge program with a term of 5", terms)
+    }
+}
+
+func TestAmortizationScheduleDates(t *testing.T) {
+    var testCases = []struct {
+        name string
+        closingDate utils.Date
+        firstPaymentDate utils.Date
+        paymentDay int
+        dayCount ff.DayCount
+        wantDueDates []utils.Date
+        wantFirstInterest ff.Money
+    }{
+        {
+            name: "Short first period",
+            closingDate: utils.NewDate(2026, time.March, 15),
+            firstPaymentDate: utils.NewDate(2027, time.January, 1),
+            paymentDay: 1,
+            wantDueDates: []utils.Date{
+                utils.NewDate(2027, time.January, 1),
+                utils.NewDate(2028, time.January, 1),
+                utils.NewDate(2029, time.January, 1),
+            },
+            wantFirstInterest: -3972222 * ff.Cent,
+        },
+        {
+            name: "Short first period Actual/360",
+            closingDate: utils.NewDate(2026, time.March, 15),
+            firstPaymentDate: utils.NewDate(2027, time.January, 1),
+            paymentDay: 1,
+            dayCount: ff.DayCountActual360,
+            wantDueDates: []utils.Date{
+                utils.NewDate(2027, time.January, 1),
+                utils.NewDate(2028, time.January, 1),
+                utils.NewDate(2029, time.January, 1),
+            },
+            wantFirstInterest: -4055556 * ff.Cent,
+        },
+        {
+            name: "Short first period Actual/365",
+            closingDate: utils.NewDate(2026, time.March, 15),
+            firstPaymentDate: utils.NewDate(2027, time.January, 1),
+            paymentDay: 1,
+            dayCount: ff.DayCountActual365,
+            wantDueDates: []utils.Date{
+                utils.NewDate(2027, time.January, 1),
+                utils.NewDate(2028, time.January, 1),
+                utils.NewDate(2029, time.January, 1),
+            },
+            wantFirstInterest: -40000 * ff.Dollar,
+        },
+        {
+            name: "Long first period",
+            closingDate: utils.NewDate(2026, time.October, 1),
+            firstPaymentDate: utils.NewDate(2028, time.January, 1),
+            paymentDay: 1,
+            wantDueDates: []utils.Date{
+                utils.NewDate(2028, time.January, 1),
+                utils.NewDate(2029, time.January, 1),
+                utils.NewDate(2030, time.January, 1),
+            },
+            wantFirstInterest: -62500 * ff.Dollar,
+        },
+        {
+            name: "Default first payment on the payment day",
+            closingDate: utils.NewDate(2026, time.January, 20),
+            paymentDay: 31,
+            wantDueDates: []utils.Date{
+                utils.NewDate(2027, time.January, 31),
+                utils.NewDate(2028, time.January, 31),
+                utils.NewDate(2029, time.January, 31),
+            },
+            wantFirstInterest: -5152778 * ff.Cent,
+        },
+    }
+
+    for _, test := range testCases {
+        t.Run(test.name, func(t *testing.T) {
+            loan, err := InitLoanSizer(LoanSizer{
+                MaxLTV: 0.50,
+                MinDSCR: 1.00,
+                Amortization: 0,
+                Term: 3,
+                Rate: 0.05,
+                PropertyValue: 2000000 * ff.Dollar,
+                NOI: 1000000 * ff.Dollar,
+                RequestedLoanAmount: 1000000 * ff.Dollar,
+                ClosingDate: test.closingDate,
+                FirstPaymentDate: test.firstPaymentDate,
+                PaymentDay: test.paymentDay,
+                DayCount: test.dayCount,
+            })
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+
+            for i, row := range loan.Schedule {
+                if !row.DueDate.Equal(test.wantDueDates[i].Time) {
+                    t.Errorf("got: %v, wanted: %v", row.DueDate, test.wantDueDates[i])
+                }
+            }
+            if got := loan.Schedule[0].Interest; got != test.wantFirstInterest {
+                t.Errorf("got: %v, wanted: %v", got, test.wantFirstInterest)
+            }
+            if got := loan.Schedule[1].Interest; got != loan.IOLoanPayment {
+                t.Errorf("got: %v, wanted: %v", got, loan.IOLoanPayment)
+            }
+        })
+    }
+}
+
+func TestDayCountBalloon(t *testing.T) {
+    loan := LoanSizer{
+        MaxLTV: 0.75,
+        MinDSCR: 1.25,
+        Amortization: 30,
+        Term: 10,
+        Rate: 0.05,
+        PropertyValue: 2000000 * ff.Dollar,
+        NOI: 500000 * ff.Dollar,
+        RequestedLoanAmount: 1000000 * ff.Dollar,
+    }
+    thirty_360, err := InitLoanSizer(loan)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    loan.DayCount = ff.DayCountActual360
+    actual_360, err := InitLoanSizer(loan)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if actual_360.LoanPayment != thirty_360.LoanPayment {
+        t.Errorf("got: %v, wanted the same level payment %v", actual_360.LoanPayment, thirty_360.LoanPayment)
+    }
+    if actual_360.BalloonPayment <= thirty_360.BalloonPayment {
+        t.Errorf("got: %v, wanted a balloon bigger than %v", actual_360.BalloonPayment, thirty_360.BalloonPayment)
+    }
+}
+
+func TestScheduleReconciles(t *testing.T) {
+    // these loans used to end a few cents away from 0 with float amounts.
+    for _, amount := range []ff.Money{100000 * ff.Dollar, 3635905 * ff.Dollar} {
+        loan, err := InitLoanSizer(LoanSizer{
+            MaxLTV: 0.75,
+            MinDSCR: 1.00,
+            Amortization: 25,
+            Term: 30,
+            Rate: 0.065,
+            PropertyValue: 10000000 * ff.Dollar,
+            NOI: 1000000 * ff.Dollar,
+            RequestedLoanAmount: amount,
+        })
+        if err != nil {
+            t.Fatalf("unexpected error: %v", err)
+        }
+        if got := loan.Schedule[loan.Amortization-1].EndingBalance; got != 0 {
+            t.Errorf("got: %v, wanted: 0.00", got)
+        }
+    }
+}
+
+func TestRoundingPolicy(t *testing.T) {
+    loan, err := InitLoanSizer(LoanSizer{
+        MaxLTV: 0.75,
+        MinDSCR: 1.25,
+        Amortization: 25,
+        Term: 10,
+        Rate: 0.065,
+        PropertyValue: 2000000 * ff.Dollar,
+        NOI: 500000 * ff.Dollar,
+        RequestedLoanAmount: 1234567 * ff.Dollar,
+        Rounding: ff.RoundingPolicy{Mode: ff.RoundHalfEven, Precision: ff.Dollar},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if loan.LoanPayment % ff.Dollar != 0 {
+        t.Errorf("got: %v, wanted a payment in whole dollars", loan.LoanPayment)
+    }
+    for _, row := range loan.Schedule {
+        if row.Interest % ff.Dollar != 0 || row.Principal % ff.Dollar != 0 {
+            t.Errorf("got: %v and %v, wanted amounts in whole dollars", row.Interest, row.Principal)
+        }
+    }
+
+    _, err = InitLoanSizer(LoanSizer{
+        Amortization: 25,
+        Term: 10,
+        Rounding: ff.RoundingPolicy{Scope: 5},
+    })
+    if err == nil {
+        t.Errorf("got no error, wanted a validation error for the rounding scope")
+    }
+}
+
+func TestImpliedRateAndRemainingTerm(t *testing.T) {
+    loan, err := InitLoanSizer(LoanSizer{
+        MaxLTV: 0.75,
+        MinDSCR: 1.25,
+        Amortization: 25,
+        Term: 10,
+        Rate: 0.065,
+        PropertyValue: 2000000 * ff.Dollar,
+        NOI: 500000 * ff.Dollar,
+        RequestedLoanAmount: 1000000 * ff.Dollar,
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    rate, err := loan.ImpliedRate(loan.LoanPayment)
+    if err != nil || ff.Round4(rate) != loan.Rate {
+        t.Errorf("got: %g, wanted: %g, error: %v", rate, loan.Rate, err)
+    }
+
+    // after 10 payments there are 15 years left of the amortization.
+    periods, err := loan.RemainingTerm(loan.BalloonPayment)
+    if err != nil || ff.Round2(periods) != 15 {
+        t.Errorf("got: %g, wanted: 15, error: %v", periods, err)
+    }
+
+    loan.Amortization = 0
+    if _, err := loan.RemainingTerm(loan.BalloonPayment); err == nil {
+        t.Errorf("got no error, wanted a validation error for interest only loans")
+    }
+
+    // the interest only payment accrues with the day count convention.
+    loan.DayCount = ff.DayCountActual360
+    loan, err = InitLoanSizer(loan)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    rate, err = loan.ImpliedRate(loan.LoanPayment)
+    if err != nil || ff.Round4(rate) != loan.Rate {
+        t.Errorf("got: %g, wanted: %g, error: %v", rate, loan.Rate, err)
+    }
+}
+
+func TestRateCompounding(t *testing.T) {
+    quote := LoanSizer{
+        MaxLTV: 0.75,
+        MinDSCR: 1.25,
+        Amortization: 25,
+        Term: 10,
+        Rate: 0.06,
+        RateCompounding: ff.CompoundingMonthly,
+        PropertyValue: 2000000 * ff.Dollar,
+        NOI: 500000 * ff.Dollar,
+        RequestedLoanAmount: 1000000 * ff.Dollar,
+    }
+    monthly, err := InitLoanSizer(quote)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // the yearly payments accrue the effective rate of the quote.
+    effective := quote
+    effective.Rate = quote.InterestRate().Effective()
+    effective.RateCompounding = 0
+    effective, err = InitLoanSizer(effective)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if monthly.LoanPayment != effective.LoanPayment || monthly.BalloonPayment != effective.BalloonPayment {
+        t.Errorf("got: %v and %v, wanted: %v and %v", monthly.LoanPayment, monthly.BalloonPayment, effective.LoanPayment, effective.BalloonPayment)
+    }
+
+    rate, err := monthly.ImpliedRate(monthly.LoanPayment)
+    if err != nil || ff.Round4(rate) != quote.Rate {
+        t.Errorf("got: %g, wanted: %g, error: %v", rate, quote.Rate, err)
+    }
+
+    quote.RateCompounding = -2
+    if _, err := InitLoanSizer(quote); err == nil {
+        t.Errorf("got no error, wanted a validation error for rate_compounding")
+    }
+}
+
+func TestPaymentFrequency(t *testing.T) {
+    quote := LoanSizer{
+        MaxLTV: 0.75,
+        MinDSCR: 1.25,
+        Amortization: 25,
+        Term: 10,
+        Rate: 0.065,
+        PropertyValue: 2000000 * ff.Dollar,
+        NOI: 150000 * ff.Dollar,
+        RequestedLoanAmount: 2000000 * ff.Dollar,
+    }
+    yearly, err := InitLoanSizer(quote)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    quote.PaymentFrequency = 12
+    monthly, err := InitLoanSizer(quote)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // the monthly payments carry more loan for the same yearly debt service.
+    if monthly.MaximumLoanAmount <= yearly.MaximumLoanAmount {
+        t.Errorf("got: %v, wanted more than: %v", monthly.MaximumLoanAmount, yearly.MaximumLoanAmount)
+    }
+    dscr := - monthly.NOI.Ratio(monthly.LoanPayment)
+    if dscr < quote.MinDSCR {
+        t.Errorf("got: %g, wanted at least: %g", dscr, quote.MinDSCR)
+    }
+
+    schedule, err := monthly.AmortizationSchedule()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(schedule) != quote.Term * 12 {
+        t.Fatalf("got: %d payments, wanted: %d", len(schedule), quote.Term * 12)
+    }
+    if schedule[0].Payment * 12 != monthly.LoanPayment {
+        t.Errorf("got: %v, wanted: %v", schedule[0].Payment * 12, monthly.LoanPayment)
+    }
+
+    // the distribution adds up the payments of every year.
+    ppmt, ipmt, err := monthly.PaymentDistribution()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(ppmt) != quote.Term || len(ipmt) != quote.Term {
+        t.Fatalf("got: %d and %d years, wanted: %d", len(ppmt), len(ipmt), quote.Term)
+    }
+    var year_one ff.Money
+    for _, row := range schedule[:12] {
+        year_one += row.Payment
+    }
+    if ppmt[0] + ipmt[0] != year_one {
+        t.Errorf("got: %v, wanted: %v", ppmt[0] + ipmt[0], year_one)
+    }
+    capital := monthly.MaximumLoanAmount
+    for _, principal := range ppmt {
+        capital += principal
+    }
+    if capital != monthly.BalloonPayment || schedule[len(schedule)-1].EndingBalance != capital {
+        t.Errorf("got: %v, wanted: %v", capital, monthly.BalloonPayment)
+    }
+
+    rate, err := monthly.ImpliedRate(monthly.LoanPayment)
+    if err != nil || ff.Round4(rate) != quote.Rate {
+        t.Errorf("got: %g, wanted: %g, error: %v", rate, quote.Rate, err)
+    }
+    years, err := monthly.RemainingTerm(monthly.BalloonPayment)
+    if err != nil || ff.Round2(years) != 15 {
+        t.Errorf("got: %g, wanted: 15, error: %v", years, err)
+    }
+
+    quote.PaymentFrequency = 3
+    if _, err := InitLoanSizer(quote); err == nil {
+        t.Errorf("got no error, wanted a validation error for payment_frequency")
+    }
+}
@@ -0,0 +1,184 @@
+// Dated amortization schedule of the loan. With a closing date every payment
+// of the schedule has its due date, and the interest of every period accrues
+// with the day count convention from the previous due date, so the first
+// payment has the stub interest of a short or long first period.
+
+package loan_sizer
+
+import (
+    "fmt"
+    ff "jacobitosuperstar/LoanSizing/internal/financial_formulas";
+    "jacobitosuperstar/LoanSizing/internal/utils";
+)
+
+// DEFAULT_PAYMENT_FREQUENCY is the number of payments in a year of a loan
+// without a payment frequency.
+const DEFAULT_PAYMENT_FREQUENCY = 1
+
+// ScheduleRow is a payment of the amortization schedule.
+type ScheduleRow struct {
+    Period              int         `json:"period"`
+    DueDate             utils.Date  `json:"due_date"`
+    BeginningBalance    ff.Money    `json:"beginning_balance"`
+    Payment             ff.Money    `json:"payment"`
+    Interest            ff.Money    `json:"interest"`
+    Principal           ff.Money    `json:"principal"`
+    EndingBalance       ff.Money    `json:"ending_balance"`
+}
+
+// payments_per_year returns the number of payments in a year, the payment
+// frequency of the loan.
+func (ls LoanSizer) payments_per_year () int {
+    if ls.PaymentFrequency == 0 {
+        return DEFAULT_PAYMENT_FREQUENCY
+    }
+    return ls.PaymentFrequency
+}
+
+// period_months returns the number of months between payments.
+func (ls LoanSizer) period_months () int {
+    return 12 / ls.payments_per_year()
+}
+
+// validate_payment_frequency checks that the payments split the year in whole
+// months.
+func (ls LoanSizer) validate_payment_frequency () error {
+    switch ls.PaymentFrequency {
+    case 0, 1, 2, 4, 12:
+        return nil
+    }
+    return &ff.ValidationError{Field: "payment_frequency", Value: ls.PaymentFrequency, Message: "The value must be 1 (annual), 2 (semi-annual), 4 (quarterly) or 12 (monthly)"}
+}
+
+// IsDated returns true when the loan has a closing date, so the schedule has
+// due dates.
+func (ls LoanSizer) IsDated () bool {
+    return !ls.ClosingDate.IsZero()
+}
+
+// first_payment_date returns the due date of the first payment. Without an
+// explicit first payment date, it is one period after the closing on the
+// payment day.
+func (ls LoanSizer) first_payment_date () utils.Date {
+    if !ls.FirstPaymentDate.IsZero() {
+        return ls.FirstPaymentDate
+    }
+    return ls.ClosingDate.AddMonths(ls.period_months(), ls.PaymentDay)
+}
+
+// DueDate returns the due date of the payment of the period, starting at 1.
+func (ls LoanSizer) DueDate (period int) utils.Date {
+    return ls.periodic_due_date(period, ls.period_months())
+}
+
+// MonthlyDueDate returns the date of the month of the term, starting at 1, on
+// the payment day of the loan. With monthly payments it is the due date of the
+// payment of the month.
+func (ls LoanSizer) MonthlyDueDate (month int) utils.Date {
+    return ls.periodic_due_date(month, 1)
+}
+
+// periodic_due_date returns the due date of the payment of the period with a
+// payment every given months. The first payment date of the loan is only used
+// with the regular periods, otherwise the first payment is one period after
+// the closing.
+func (ls LoanSizer) periodic_due_date (period int, months int) utils.Date {
+    if !ls.IsDated() {
+        return utils.Date{}
+    }
+    first_payment := ls.ClosingDate.AddMonths(months, ls.PaymentDay)
+    if months == ls.period_months() {
+        first_payment = ls.first_payment_date()
+    }
+    return first_payment.AddMonths((period - 1) * months, ls.PaymentDay)
+}
+
+// accrual_fractions returns the fraction of a period accrued on every period
+// of the term, with a payment every given months. Without dates every period
+// is the part of a 365 days year.
+func (ls LoanSizer) accrual_fractions (months int) ([]float64, error) {
+    payments_per_year := 12 / months
+    accruals := make([]float64, ls.Term * payments_per_year)
+    if !ls.IsDated() {
+        accrual, err := ff.NominalYearFraction(ls.DayCount)
+        if err != nil {
+            return nil, fmt.Errorf("NominalYearFraction internal error: %v", err)
+        }
+        for i := range accruals {
+            accruals[i] = accrual
+        }
+        return accruals, nil
+    }
+
+    start := ls.ClosingDate
+    for i := range accruals {
+        due_date := ls.periodic_due_date(i + 1, months)
+        accrual, err := ff.YearFraction(ls.DayCount, start.Time, due_date.Time)
+        if err != nil {
+            return nil, fmt.Errorf("YearFraction internal error: %v", err)
+        }
+        accruals[i] = accrual * float64(payments_per_year)
+        start = due_date
+    }
+    return accruals, nil
+}
+
+// validate_dates checks that the closing, the first payment and the payment
+// day are consistent.
+func (ls LoanSizer) validate_dates () error {
+    if ls.PaymentDay < 0 || ls.PaymentDay > 31 {
+        return &ff.ValidationError{Field: "payment_day", Value: ls.PaymentDay, Message: "The value must be between 1 and 31, or 0 to use the day of the first payment"}
+    }
+    if !ls.IsDated() {
+        if !ls.FirstPaymentDate.IsZero() {
+            return &ff.ValidationError{Field: "closing_date", Value: ls.ClosingDate, Message: "The closing date is needed with a first payment date"}
+        }
+        return nil
+    }
+    first_payment := ls.first_payment_date()
+    if !first_payment.After(ls.ClosingDate.Time) {
+        return &ff.ValidationError{Field: "first_payment_date", Value: first_payment, Message: "The value must be after the closing date"}
+    }
+    // a first period longer than two regular periods is not a stub anymore.
+    if first_payment.After(ls.ClosingDate.AddMonths(2 * ls.period_months(), 0).Time) {
+        return &ff.ValidationError{Field: "first_payment_date", Value: first_payment, Message: "The first period can't be longer than two regular periods"}
+    }
+    return nil
+}
+
+// AmortizationSchedule returns the payments of the loan during the term with
+// their due dates and balances, a row for every payment.
+func (ls LoanSizer) AmortizationSchedule () ([]ScheduleRow, error) {
+    ppmt, ipmt, err := ls.payment_schedule()
+    if err != nil {
+        return nil, fmt.Errorf("payment_schedule internal error: %v", err)
+    }
+
+    schedule := make([]ScheduleRow, len(ppmt))
+    balance := ls.MaximumLoanAmount
+    for i := range schedule {
+        ending_balance := balance + ppmt[i]
+        schedule[i] = ScheduleRow{
+            Period: i + 1,
+            DueDate: ls.DueDate(i + 1),
+            BeginningBalance: balance,
+            Payment: ppmt[i] + ipmt[i],
+            Interest: ipmt[i],
+            Principal: ppmt[i],
+            EndingBalance: ending_balance,
+        }
+        balance = ending_balance
+    }
+    return schedule, nil
+}
+
+// SetSchedule sets the dated amortization schedule of the loan
+func (ls *LoanSizer) SetSchedule () error {
+    schedule, err := ls.AmortizationSchedule()
+    if err != nil {
+        ls.Schedule = nil
+        return fmt.Errorf("AmortizationSchedule internal error: %v", err)
+    }
+    ls.Schedule = schedule
+    return nil
+}
@@ -1,2 +1,70 @@
 // Package wide utilities
 package utils
+
+import (
+    "time";
+    "encoding/json";
+)
+
+const DATE_FORMAT = "2006-01-02"
+
+
+// Date is a calendar date that is represented as YYYY-MM-DD in JSON. The zero
+// Date is represented as null.
+type Date struct {
+    time.Time
+}
+
+// NewDate returns the Date of the given year, month and day.
+func NewDate(year int, month time.Month, day int) Date {
+    return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// MarshalJSON returns the YYYY-MM-DD representation of the Date.
+func (d Date) MarshalJSON() ([]byte, error) {
+    if d.IsZero() {
+        return []byte("null"), nil
+    }
+    return json.Marshal(d.Format(DATE_FORMAT))
+}
+
+// UnmarshalJSON parses a YYYY-MM-DD date.
+func (d *Date) UnmarshalJSON(data []byte) error {
+    var value *string
+    err := json.Unmarshal(data, &value)
+    if err != nil {
+        return err
+    }
+    if value == nil || *value == "" {
+        d.Time = time.Time{}
+        return nil
+    }
+    t, err := time.Parse(DATE_FORMAT, *value)
+    if err != nil {
+        return err
+    }
+    d.Time = t
+    return nil
+}
+
+// AddMonths returns the Date the given months later on the given day of the
+// month. The day is moved to the end of the month on shorter months, and a day
+// of 0 keeps the day of the Date.
+func (d Date) AddMonths(months int, day int) Date {
+    if day <= 0 {
+        day = d.Day()
+    }
+    // first day of the target month, so AddDate doesn't overflow the month.
+    first := time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, months, 0)
+    last_day := first.AddDate(0, 1, -1).Day()
+    if day > last_day {
+        day = last_day
+    }
+    return NewDate(first.Year(), first.Month(), day)
+}
+
+// MonthsBetween returns the number of calendar months from the month of start
+// to the month of end, without looking at the days.
+func MonthsBetween(start Date, end Date) int {
+    return (end.Year() - start.Year()) * 12 + int(end.Month()) - int(start.Month())
+}